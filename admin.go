@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupAdminRouter registers the routes of the internal admin listener,
+// which is meant for operators and kept off the public address. Profiles
+// are only served when asked for, which is when clients are authenticated
+// by their certificate.
+func setupAdminRouter(profiling bool) *gin.Engine {
+	router := gin.New()
+	router.Use(requestLogMiddleware(), gin.Recovery(), problemMiddleware())
+	router.NoRoute(notFound)
+
+	router.GET("/healthz", healthCheck)
+	router.GET("/livez", livenessCheck)
+	router.GET("/readyz", readinessCheck(true))
+	router.GET("/metrics", getMetrics)
+
+	if !profiling {
+		return router
+	}
+
+	// Profiles of the running process. The command line isn't served as
+	// it can hold the database password.
+	debug := router.Group("/debug/pprof")
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	debug.GET("/:profile", func(c *gin.Context) {
+		if c.Param("profile") == "cmdline" {
+			notFound(c)
+			return
+		}
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+
+	return router
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"app/assignment/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Versions of the API, each served under its own route group
+const (
+	apiV1 = "v1"
+	apiV2 = "v2"
+)
+
+const apiVersionKey = "api_version"
+
+var (
+	// apiV1Deprecated is when v2 superseded v1
+	apiV1Deprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	// apiV1Sunset is when v1 stops being served
+	apiV1Sunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// apiVersion records the API version of the route group in the context, so
+// handlers shared between versions can render the matching representation.
+func apiVersion(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, version)
+		c.Next()
+	}
+}
+
+// deprecatedAPI announces on every response of a route group that it is
+// deprecated (RFC 9745) and when it goes away (RFC 8594), pointing to the
+// same route in the successor version.
+func deprecatedAPI(deprecated time.Time, sunset time.Time, successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+		c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+
+		if _, rest, ok := strings.Cut(strings.TrimPrefix(c.Request.URL.Path, "/"), "/"); ok {
+			c.Header("Link", "</"+successor+"/"+rest+`>; rel="successor-version"`)
+		}
+
+		c.Next()
+	}
+}
+
+// renderAssignment answers with the assignment in the representation of the
+// API version of the request.
+func renderAssignment(c *gin.Context, status int, assignment models.Assignment) {
+	if c.GetString(apiVersionKey) == apiV2 {
+		c.JSON(status, newAssignmentResponseV2(assignment))
+		return
+	}
+
+	c.JSON(status, newAssignmentResponse(assignment))
+}
+
+// assignmentResponses lists the assignments in the representation of the API
+// version of the request.
+func assignmentResponses(c *gin.Context, assignments []models.Assignment) interface{} {
+	if c.GetString(apiVersionKey) == apiV2 {
+		responses := []models.AssignmentResponseV2{}
+		for _, assignment := range assignments {
+			responses = append(responses, newAssignmentResponseV2(assignment))
+		}
+		return responses
+	}
+
+	responses := []models.AssignmentResponse{}
+	for _, assignment := range assignments {
+		responses = append(responses, newAssignmentResponse(assignment))
+	}
+	return responses
+}
+
+func newAssignmentResponseV2(assignment models.Assignment) models.AssignmentResponseV2 {
+	response := models.AssignmentResponseV2{
+		ID:                 assignment.ID,
+		Name:               assignment.Name,
+		Points:             assignment.Points,
+		NoOfAttempts:       assignment.NoOfAttempts,
+		Deadline:           rfc3339Deadline(assignment.Deadline),
+		LatePolicy:         assignment.LatePolicy,
+		GracePeriodMinutes: assignment.GracePeriodMinutes,
+		LateUntil:          rfc3339Deadline(assignment.LateUntil),
+		LatePenaltyPerDay:  assignment.LatePenaltyPerDay,
+		Status:             assignment.Status,
+		CourseID:           assignment.CourseID,
+		TeamMode:           assignment.TeamMode,
+		MaxTeamSize:        assignment.MaxTeamSize,
+		Rubric:             newRubricResponse(assignment.Rubric),
+		CreatedAt:          assignment.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:          assignment.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if assignment.PublishAt != nil {
+		publishAt := assignment.PublishAt.UTC().Format(time.RFC3339)
+		response.PublishAt = &publishAt
+	}
+
+	return response
+}
+
+// rfc3339Deadline converts a date stored in the deadline format to RFC 3339,
+// leaving empty or unreadable dates as they are.
+func rfc3339Deadline(deadline string) string {
+	t, err := time.Parse(deadlineLayout, deadline)
+	if err != nil {
+		return deadline
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
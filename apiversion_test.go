@@ -0,0 +1,63 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIVersions(t *testing.T) {
+
+	created := time.Date(2026, time.September, 1, 8, 30, 0, 0, time.UTC)
+	assignment := models.Assignment{Name: "Essay", Points: 10, NoOfAttempts: 2, Deadline: "2026-12-01T23:59:00.000Z"}
+	assignment.ID = 7
+	assignment.CreatedAt = created
+	assignment.UpdatedAt = created
+
+	router := gin.New()
+	v1 := router.Group("/v1", apiVersion(apiV1), deprecatedAPI(apiV1Deprecated, apiV1Sunset, apiV2))
+	v2 := router.Group("/v2", apiVersion(apiV2))
+	for _, api := range []*gin.RouterGroup{v1, v2} {
+		api.GET("/assignments/:id", func(c *gin.Context) {
+			renderAssignment(c, http.StatusOK, assignment)
+		})
+	}
+
+	// v1 keeps its keys and announces its sunset
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/assignments/7", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1792368000", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Wed, 30 Jun 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v2/assignments/7>; rel="successor-version"`, w.Header().Get("Link"))
+
+	var v1Body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &v1Body))
+	assert.Equal(t, float64(7), v1Body["ID"])
+	assert.Equal(t, float64(2), v1Body["noofattempts"])
+	assert.Equal(t, created.String(), v1Body["AssignemtCreated"])
+	assert.Equal(t, created.String(), v1Body["AssignmentUpdated"])
+
+	// v2 uses snake_case keys and RFC 3339 timestamps
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/assignments/7", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Empty(t, w.Header().Get("Sunset"))
+
+	var v2Body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &v2Body))
+	assert.Equal(t, float64(7), v2Body["id"])
+	assert.Equal(t, float64(2), v2Body["no_of_attempts"])
+	assert.Equal(t, "2026-12-01T23:59:00Z", v2Body["deadline"])
+	assert.Equal(t, "2026-09-01T08:30:00Z", v2Body["created_at"])
+	assert.Equal(t, "2026-09-01T08:30:00Z", v2Body["updated_at"])
+	assert.Nil(t, v2Body["publish_at"])
+	assert.NotContains(t, v2Body, "ID")
+}
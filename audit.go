@@ -0,0 +1,27 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// recordAudit appends an event to the audit trail within the given
+// transaction, so the event is only kept when the change itself is.
+func recordAudit(tx *gorm.DB, accountID uint, action string, resource string, resourceID uint, detail interface{}) error {
+	detailJSON, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+
+	event := models.AuditEvent{
+		AccountID:  accountID,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Detail:     string(detailJSON),
+	}
+
+	return tx.Create(&event).Error
+}
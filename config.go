@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file read when neither -config nor CONFIG_FILE name one,
+// written by the user data of the instance
+const defaultConfigFile = "/opt/dbconfig.yaml"
+
+// appConfig holds every setting of the webapp. Each setting is read, from the
+// lowest to the highest precedence, from the defaults, the configuration
+// file, its environment variable and its command line flag.
+type appConfig struct {
+	Database  databaseConfig `yaml:"database"`
+	SNS       snsConfig      `yaml:"sns"`
+	Secrets   secretsConfig  `yaml:"secrets"`
+	UsersFile string         `yaml:"users_file"` // accounts created on startup
+	Server    serverConfig   `yaml:"server"`
+	Log       logConfig      `yaml:"log"`
+	Metrics   metricsConfig  `yaml:"metrics"`
+	Tracing   tracingConfig  `yaml:"tracing"`
+}
+
+// databaseConfig holds the settings of the database. The user and password
+// can reference secrets kept elsewhere, as file:// or secretsmanager://
+type databaseConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Name     string `yaml:"name"`
+}
+
+func (c databaseConfig) validate() error {
+	var errs []error
+	if c.User == "" {
+		errs = append(errs, errors.New("database.user is required"))
+	}
+	if c.Host == "" {
+		errs = append(errs, errors.New("database.host is required"))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("database.port should be a port number, got %d", c.Port))
+	}
+	if c.Name == "" {
+		errs = append(errs, errors.New("database.name is required"))
+	}
+	return errors.Join(errs...)
+}
+
+type snsConfig struct {
+	TopicArn       string        `yaml:"topic_arn"` // submission notifications
+	Region         string        `yaml:"region"`
+	PublishTimeout time.Duration `yaml:"publish_timeout"` // of each notification
+}
+
+func (c snsConfig) validate() error {
+	var errs []error
+	if c.TopicArn == "" {
+		errs = append(errs, errors.New("sns.topic_arn is required"))
+	}
+	if c.PublishTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("sns.publish_timeout should be a positive duration such as 10s, got %s", c.PublishTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+// DbConfig is the layout of the configuration file of earlier versions,
+// still written by the user data of the instance. Its flat keys set the
+// database and SNS settings.
+type DbConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	DB       string `yaml:"db"`
+	SnsArn   string `yaml:"snsarn"`
+}
+
+// configFile is the layout of the configuration file
+type configFile struct {
+	appConfig `yaml:",inline"`
+	DbConfig  `yaml:",inline"`
+}
+
+func defaultConfig() appConfig {
+	return appConfig{
+		Database: databaseConfig{
+			Host: "127.0.0.1",
+			Port: 3306,
+		},
+		SNS: snsConfig{
+			Region:         "us-east-1",
+			PublishTimeout: 10 * time.Second,
+		},
+		Secrets: secretsConfig{
+			Region:          "us-east-1",
+			RefreshInterval: 5 * time.Minute,
+		},
+		UsersFile: "users.csv",
+		Server: serverConfig{
+			Addr:            ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			MaxHeaderBytes:  1 << 20,
+			ShutdownTimeout: 25 * time.Second, // below TimeoutStopSec of myapp.service
+			TLSMinVersion:   "1.2",
+		},
+		Log: logConfig{
+			Level:        zerolog.InfoLevel,
+			Format:       "json",
+			Outputs:      []string{"file", "stdout"},
+			RedactFields: []string{"email"},
+			File:         "app.log",
+			MaxSizeMB:    100,
+			MaxAgeDays:   28,
+			MaxBackups:   10,
+			Compress:     true,
+		},
+		Metrics: metricsConfig{
+			Backends:   []string{"statsd"},
+			StatsdAddr: "127.0.0.1:8125",
+		},
+		Tracing: tracingConfig{
+			Exporter: "none",
+		},
+	}
+}
+
+// setting binds a field of the config to its key in the configuration
+// file, its environment variable and its command line flag.
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	value interface{} // pointer to the field
+}
+
+func (c *appConfig) settings() []setting {
+	return []setting{
+		{"database.user", "DB_USER", "db-user", "user of the MySQL database, or a reference to it", &c.Database.User},
+		{"database.password", "DB_PASSWORD", "db-password", "password of the MySQL user, or a reference to it such as file:///run/secrets/db_password", &c.Database.Password},
+		{"database.host", "DB_HOST", "db-host", "host of the MySQL server", &c.Database.Host},
+		{"database.port", "DB_PORT", "db-port", "port of the MySQL server", &c.Database.Port},
+		{"database.name", "DB_NAME", "db-name", "name of the database, created when missing", &c.Database.Name},
+		{"sns.topic_arn", "SNS_TOPIC_ARN", "sns-topic-arn", "ARN of the SNS topic of submission notifications", &c.SNS.TopicArn},
+		{"sns.region", "SNS_REGION", "sns-region", "AWS region of the SNS topic", &c.SNS.Region},
+		{"sns.publish_timeout", "SNS_PUBLISH_TIMEOUT", "sns-publish-timeout", "time to publish a notification", &c.SNS.PublishTimeout},
+		{"secrets.region", "SECRETS_REGION", "secrets-region", "AWS region of Secrets Manager", &c.Secrets.Region},
+		{"secrets.endpoint", "SECRETS_ENDPOINT", "secrets-endpoint", "endpoint of Secrets Manager, such as a local stand-in, AWS when empty", &c.Secrets.Endpoint},
+		{"secrets.refresh_interval", "SECRETS_REFRESH_INTERVAL", "secrets-refresh-interval", "time after which referenced secrets are read again, 0 for never", &c.Secrets.RefreshInterval},
+		{"users_file", "USERS_PATH", "users-file", "CSV file of the accounts created on startup", &c.UsersFile},
+
+		{"server.addr", "HTTP_ADDR", "http-addr", "address the API listens on, :$PORT when neither this nor the file sets it", &c.Server.Addr},
+		{"server.read_timeout", "HTTP_READ_TIMEOUT", "http-read-timeout", "time to read a request", &c.Server.ReadTimeout},
+		{"server.write_timeout", "HTTP_WRITE_TIMEOUT", "http-write-timeout", "time to write a response", &c.Server.WriteTimeout},
+		{"server.idle_timeout", "HTTP_IDLE_TIMEOUT", "http-idle-timeout", "time a keep-alive connection stays open", &c.Server.IdleTimeout},
+		{"server.max_header_bytes", "HTTP_MAX_HEADER_BYTES", "http-max-header-bytes", "maximum size of request headers", &c.Server.MaxHeaderBytes},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "time to drain requests and notifications on shutdown", &c.Server.ShutdownTimeout},
+		{"server.tls_cert_file", "TLS_CERT_FILE", "tls-cert-file", "certificate of the API, served over HTTPS when given", &c.Server.TLSCertFile},
+		{"server.tls_key_file", "TLS_KEY_FILE", "tls-key-file", "private key of the certificate of the API", &c.Server.TLSKeyFile},
+		{"server.tls_min_version", "TLS_MIN_VERSION", "tls-min-version", "minimum TLS version, 1.2 or 1.3", &c.Server.TLSMinVersion},
+		{"server.admin_addr", "ADMIN_ADDR", "admin-addr", "address of the admin listener, off when empty", &c.Server.AdminAddr},
+		{"server.admin_tls_cert_file", "ADMIN_TLS_CERT_FILE", "admin-tls-cert-file", "certificate of the admin listener, the one of the API by default", &c.Server.AdminCertFile},
+		{"server.admin_tls_key_file", "ADMIN_TLS_KEY_FILE", "admin-tls-key-file", "private key of the certificate of the admin listener", &c.Server.AdminKeyFile},
+		{"server.admin_tls_client_ca_file", "ADMIN_TLS_CLIENT_CA_FILE", "admin-tls-client-ca-file", "CA client certificates of the admin listener must be signed by", &c.Server.AdminClientCAFile},
+
+		{"log.level", "LOG_LEVEL", "log-level", "debug, info, warn or error", &c.Log.Level},
+		{"log.format", "LOG_FORMAT", "log-format", "json or console", &c.Log.Format},
+		{"log.outputs", "LOG_OUTPUTS", "log-outputs", "comma separated list of file and stdout", &c.Log.Outputs},
+		{"log.redact_fields", "LOG_REDACT_FIELDS", "log-redact-fields", "comma separated list of the fields of personal data masked in logs, or none", &c.Log.RedactFields},
+		{"log.file", "LOG_FILE", "log-file", "path of the log file", &c.Log.File},
+		{"log.max_size_mb", "LOG_MAX_SIZE_MB", "log-max-size-mb", "size the log file is rotated at", &c.Log.MaxSizeMB},
+		{"log.rotate_interval", "LOG_ROTATE_INTERVAL", "log-rotate-interval", "time the log file is rotated after, 0 for never", &c.Log.RotateInterval},
+		{"log.max_age_days", "LOG_MAX_AGE_DAYS", "log-max-age-days", "days rotated log files are kept, 0 for no limit", &c.Log.MaxAgeDays},
+		{"log.max_backups", "LOG_MAX_BACKUPS", "log-max-backups", "rotated log files kept, 0 for no limit", &c.Log.MaxBackups},
+		{"log.compress", "LOG_COMPRESS", "log-compress", "compress rotated log files", &c.Log.Compress},
+
+		{"metrics.backends", "METRICS_BACKENDS", "metrics-backends", "comma separated list of statsd, prometheus or none", &c.Metrics.Backends},
+		{"metrics.statsd_addr", "STATSD_ADDR", "statsd-addr", "host:port of the StatsD listener", &c.Metrics.StatsdAddr},
+
+		{"tracing.exporter", "OTEL_TRACES_EXPORTER", "traces-exporter", "otlp, stdout or none", &c.Tracing.Exporter},
+	}
+}
+
+// configFlags holds the command line flags given, applied once the
+// configuration file and the environment they take precedence over are read.
+type configFlags struct {
+	file   string
+	values []flagValue
+}
+
+type flagValue struct {
+	name  string
+	value string
+}
+
+// recordedFlag records the values of a flag in configFlags
+type recordedFlag struct {
+	name   string
+	flags  *configFlags
+	isBool bool
+}
+
+func (f recordedFlag) String() string {
+	return ""
+}
+
+func (f recordedFlag) Set(value string) error {
+	f.flags.values = append(f.flags.values, flagValue{name: f.name, value: value})
+	return nil
+}
+
+func (f recordedFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// newConfigFlagSet returns the flags of every setting, recorded in flags
+func newConfigFlagSet(name string, flags *configFlags) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.StringVar(&flags.file, "config", "", "configuration file, "+defaultConfigFile+" by default (CONFIG_FILE)")
+
+	var c appConfig
+	for _, s := range c.settings() {
+		_, isBool := s.value.(*bool)
+		flagSet.Var(recordedFlag{name: s.flag, flags: flags, isBool: isBool}, s.flag, s.usage+" ("+s.key+", "+s.env+")")
+	}
+	return flagSet
+}
+
+// loadConfig reads the configuration from the file, the environment and the
+// flags, and validates it.
+func loadConfig(flags configFlags, getenv func(string) string) (appConfig, error) {
+	c := defaultConfig()
+	// Left empty to tell whether the file sets the address
+	defaultAddr := c.Server.Addr
+	c.Server.Addr = ""
+
+	file := flags.file
+	if file == "" {
+		file = getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := c.readFile(file); err != nil {
+			return c, err
+		}
+	} else if err := c.readFile(defaultConfigFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return c, err
+	}
+
+	// Like gin, PORT gives the port when the file doesn't set the address;
+	// HTTP_ADDR and -http-addr still override it below
+	if c.Server.Addr == "" {
+		c.Server.Addr = defaultAddr
+		if port := getenv("PORT"); port != "" {
+			c.Server.Addr = ":" + port
+		}
+	}
+
+	byFlag := map[string]setting{}
+	for _, s := range c.settings() {
+		byFlag[s.flag] = s
+		if value := getenv(s.env); value != "" {
+			if err := setSetting(s.value, value); err != nil {
+				return c, fmt.Errorf("%s should be %s, got %q", s.env, err, value)
+			}
+		}
+	}
+
+	for _, f := range flags.values {
+		if err := setSetting(byFlag[f.name].value, f.value); err != nil {
+			return c, fmt.Errorf("-%s should be %s, got %q", f.name, err, f.value)
+		}
+	}
+
+	return c, c.validate()
+}
+
+// readFile reads the settings of a configuration file, rejecting unknown
+// keys so that typos don't go unnoticed. Files in the flat layout of earlier
+// versions are written by user data outside the webapp, so their unknown keys
+// are only warned about.
+func (c *appConfig) readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read the configuration file: %w", err)
+	}
+
+	file := configFile{appConfig: *c}
+	if err := decodeConfigFile(content, &file, true); err != nil {
+		if !isLegacyConfigFile(content) {
+			return fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+		unknown := err
+
+		file = configFile{appConfig: *c}
+		if err := decodeConfigFile(content, &file, false); err != nil {
+			return fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+		log.Warn().Err(unknown).Str("file", path).Msg("Ignoring the unknown keys of the configuration file")
+	}
+	*c = file.appConfig
+
+	legacy := file.DbConfig
+	if legacy.Port != "" {
+		port, err := strconv.Atoi(legacy.Port)
+		if err != nil {
+			return fmt.Errorf("invalid configuration file %s: port should be a number, got %q", path, legacy.Port)
+		}
+		c.Database.Port = port
+	}
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{legacy.User, &c.Database.User},
+		{legacy.Password, &c.Database.Password},
+		{legacy.Host, &c.Database.Host},
+		{legacy.DB, &c.Database.Name},
+		{legacy.SnsArn, &c.SNS.TopicArn},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	return nil
+}
+
+// setSetting parses the value of a setting given as text into the field it
+// points to, returning what was expected when it doesn't parse.
+func setSetting(field interface{}, value string) error {
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("a number")
+		}
+		*field = parsed
+	case *bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("true or false")
+		}
+		*field = parsed
+	case *time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("a duration such as 30s")
+		}
+		*field = parsed
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	case *zerolog.Level:
+		level, err := zerolog.ParseLevel(strings.ToLower(value))
+		if err != nil {
+			return errors.New("debug, info, warn or error")
+		}
+		*field = level
+	default:
+		return fmt.Errorf("a setting of type %T", field)
+	}
+	return nil
+}
+
+func decodeConfigFile(content []byte, file *configFile, knownFields bool) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(knownFields)
+	if err := decoder.Decode(file); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// isLegacyConfigFile tells whether a configuration file sets the flat keys of
+// DbConfig rather than the sections of appConfig
+func isLegacyConfigFile(content []byte) bool {
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(content, &keys); err != nil {
+		return false
+	}
+	for _, key := range []string{"user", "password", "host", "port", "db", "snsarn"} {
+		if _, ok := keys[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c appConfig) validate() error {
+	return errors.Join(
+		c.Database.validate(),
+		c.SNS.validate(),
+		c.Secrets.validate(),
+		c.Server.validate(),
+		c.Log.validate(),
+		c.Metrics.validate(),
+		c.Tracing.validate(),
+	)
+}
+
+// redacted returns the configuration with its secrets masked. References
+// to secrets are kept, as they don't disclose them.
+func (c appConfig) redacted() appConfig {
+	if c.Database.Password != "" && !isSecretRef(c.Database.Password) {
+		c.Database.Password = redacted
+	}
+	return c
+}
+
+// configCommand runs the config subcommand: `config print` writes the
+// configuration the webapp would run with, in the layout of the
+// configuration file, with its secrets masked when given -redacted.
+func configCommand(args []string, getenv func(string) string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, "usage: config print [-redacted] [flags]")
+		return 2
+	}
+
+	var flags configFlags
+	flagSet := newConfigFlagSet("config print", &flags)
+	flagSet.SetOutput(stderr)
+	redact := flagSet.Bool("redacted", false, "mask the secrets")
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	c, err := loadConfig(flags, getenv)
+	if err != nil {
+		fmt.Fprintln(stderr, "Invalid configuration:", err)
+		return 1
+	}
+	if *redact {
+		c = c.redacted()
+	}
+
+	encoder := yaml.NewEncoder(stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		fmt.Fprintln(stderr, "Unable to print the configuration:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEnv stands for the environment of the process
+type testEnv map[string]string
+
+func (e testEnv) get(name string) string {
+	return e[name]
+}
+
+// emptyConfigFile keeps the configuration file of the machine running the
+// tests out of them
+func emptyConfigFile(t *testing.T) string {
+	return writeConfigFile(t, "")
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestConfigPrecedence(t *testing.T) {
+
+	file := writeConfigFile(t, `
+database:
+  user: webapp
+  name: webapp
+sns:
+  topic_arn: arn:aws:sns:us-east-1:123456789012:submissions
+server:
+  addr: ":8000"
+  read_timeout: 5s
+log:
+  level: warn
+  outputs: [stdout]
+metrics:
+  backends: [prometheus]
+`)
+
+	// The file wins over the defaults
+	config, err := loadConfig(configFlags{file: file}, testEnv{}.get)
+	require.NoError(t, err)
+	assert.Equal(t, ":8000", config.Server.Addr)
+	assert.Equal(t, 5*time.Second, config.Server.ReadTimeout)
+	assert.Equal(t, 30*time.Second, config.Server.WriteTimeout)
+	assert.Equal(t, zerolog.WarnLevel, config.Log.Level)
+	assert.Equal(t, []string{"stdout"}, config.Log.Outputs)
+	assert.Equal(t, []string{"prometheus"}, config.Metrics.Backends)
+	assert.Equal(t, 3306, config.Database.Port)
+
+	// The environment wins over the file, and flags over the environment
+	env := testEnv{"HTTP_ADDR": ":8001", "LOG_LEVEL": "error", "DB_PORT": "3307"}
+	var flags configFlags
+	require.NoError(t, newConfigFlagSet("webapp", &flags).Parse([]string{"-config", file, "-http-addr", ":8002", "-log-compress=false"}))
+	config, err = loadConfig(flags, env.get)
+	require.NoError(t, err)
+	assert.Equal(t, ":8002", config.Server.Addr)
+	assert.Equal(t, zerolog.ErrorLevel, config.Log.Level)
+	assert.Equal(t, 3307, config.Database.Port)
+	assert.False(t, config.Log.Compress)
+
+	// CONFIG_FILE names the file when -config doesn't
+	config, err = loadConfig(configFlags{}, testEnv{"CONFIG_FILE": file}.get)
+	require.NoError(t, err)
+	assert.Equal(t, ":8000", config.Server.Addr)
+
+	_, err = loadConfig(configFlags{}, testEnv{"CONFIG_FILE": file, "DB_PORT": "mysql"}.get)
+	assert.EqualError(t, err, `DB_PORT should be a number, got "mysql"`)
+
+	var badFlags configFlags
+	require.NoError(t, newConfigFlagSet("webapp", &badFlags).Parse([]string{"-config", file, "-log-rotate-interval", "daily"}))
+	_, err = loadConfig(badFlags, testEnv{}.get)
+	assert.EqualError(t, err, `-log-rotate-interval should be a duration such as 30s, got "daily"`)
+}
+
+func TestLegacyConfigFile(t *testing.T) {
+
+	// As written by the user data of the instance
+	file := writeConfigFile(t, `
+user: webapp
+password: s3cr3t
+host: db.internal
+port: "3306"
+db: assignments
+snsarn: arn:aws:sns:us-east-1:123456789012:submissions
+`)
+
+	config, err := loadConfig(configFlags{file: file}, testEnv{}.get)
+	require.NoError(t, err)
+	assert.Equal(t, databaseConfig{User: "webapp", Password: "s3cr3t", Host: "db.internal", Port: 3306, Name: "assignments"}, config.Database)
+	assert.Equal(t, "arn:aws:sns:us-east-1:123456789012:submissions", config.SNS.TopicArn)
+	mysqlConfig := config.Database.mysqlConfig("webapp", "s3cr3t", true)
+	assert.Equal(t, "db.internal:3306", mysqlConfig.Addr)
+	assert.Equal(t, "assignments", mysqlConfig.DBName)
+	assert.True(t, mysqlConfig.ParseTime)
+	assert.Empty(t, config.Database.mysqlConfig("webapp", "s3cr3t", false).DBName)
+
+	// Keys the user data adds are ignored rather than refused
+	config, err = loadConfig(configFlags{file: writeConfigFile(t, "user: webapp\ndb: assignments\nsnsarn: arn:aws:sns:us-east-1:123456789012:submissions\nbucket: attachments\n")}, testEnv{}.get)
+	require.NoError(t, err)
+	assert.Equal(t, "assignments", config.Database.Name)
+
+	// but the keys they have are still checked
+	_, err = loadConfig(configFlags{file: writeConfigFile(t, "user: webapp\nport: [3306]\n")}, testEnv{}.get)
+	assert.Error(t, err)
+}
+
+func TestConfigErrors(t *testing.T) {
+
+	// Typos in the file are reported
+	_, err := loadConfig(configFlags{file: writeConfigFile(t, "server:\n  adress: \":80\"\n")}, testEnv{}.get)
+	assert.ErrorContains(t, err, "field adress not found")
+
+	// A file asked for has to exist
+	_, err = loadConfig(configFlags{file: filepath.Join(t.TempDir(), "missing.yaml")}, testEnv{}.get)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Every invalid setting is reported at once
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, testEnv{"LOG_FORMAT": "xml", "OTEL_TRACES_EXPORTER": "jaeger"}.get)
+	assert.EqualError(t, err, "database.user is required\n"+
+		"database.name is required\n"+
+		"sns.topic_arn is required\n"+
+		`log.format should be json or console, got "xml"`+"\n"+
+		`tracing.exporter should be otlp, stdout or none, got "jaeger"`)
+}
+
+func TestConfigPrint(t *testing.T) {
+
+	file := writeConfigFile(t, "user: webapp\npassword: s3cr3t\ndb: assignments\nsnsarn: arn:aws:sns:us-east-1:123456789012:submissions\n")
+
+	var stdout, stderr bytes.Buffer
+	code := configCommand([]string{"print", "-redacted", "-config", file, "-log-level", "debug"}, testEnv{}.get, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.NotContains(t, stdout.String(), "s3cr3t")
+	assert.Contains(t, stdout.String(), "password: '[REDACTED]'")
+	assert.Contains(t, stdout.String(), "level: debug")
+
+	// The output is a configuration file of the same settings
+	printed, err := loadConfig(configFlags{file: writeConfigFile(t, stdout.String())}, testEnv{}.get)
+	require.NoError(t, err)
+	config, err := loadConfig(configFlags{file: file, values: []flagValue{{"log-level", "debug"}}}, testEnv{}.get)
+	require.NoError(t, err)
+	assert.Equal(t, config.redacted(), printed)
+
+	stdout.Reset()
+	code = configCommand([]string{"print", "-config", file}, testEnv{}.get, &stdout, &stderr)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "password: s3cr3t")
+
+	assert.Equal(t, 1, configCommand([]string{"print", "-config", emptyConfigFile(t)}, testEnv{}.get, &stdout, &stderr))
+	assert.Equal(t, 2, configCommand([]string{"show"}, testEnv{}.get, &stdout, &stderr))
+}
@@ -3,29 +3,37 @@ package controllers
 import (
 	"app/assignment/models"
 	"fmt"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+var tracer = otel.Tracer("app/assignment/controllers")
+
+// AuthenticateUser checks the basic auth credentials of the request and
+// returns the ID of the account. Answering a failed authentication is left
+// to the caller.
 func AuthenticateUser(c *gin.Context, db *gorm.DB) (uint, error) {
 	user, password, _ := c.Request.BasicAuth()
 
 	// Query the database for the user
 	var currentUser models.Account
-	if err := db.Where("email = ?", user).First(&currentUser).Error; err != nil {
-		println("ERR CURR USER")
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "User not found"})
-		c.Abort()
+	if err := db.WithContext(c.Request.Context()).Where("email = ?", user).First(&currentUser).Error; err != nil {
 		return 0, fmt.Errorf("USER NOT FOUND")
 	}
 
-	// Compare the provided password with the stored bcrypt hash
-	if err := bcrypt.CompareHashAndPassword([]byte(currentUser.Password), []byte(password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid credentials"})
-		c.Abort()
+	// Compare the provided password with the stored bcrypt hash, which is
+	// deliberately slow
+	_, span := tracer.Start(c.Request.Context(), "bcrypt.CompareHashAndPassword")
+	err := bcrypt.CompareHashAndPassword([]byte(currentUser.Password), []byte(password))
+	if err != nil {
+		span.SetStatus(codes.Error, "password mismatch")
+	}
+	span.End()
+	if err != nil {
 		return 0, fmt.Errorf("INVALID CREDENTIALS")
 	}
 
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func createCourse(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("createcourse_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("CreateCourse Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CreateCourse Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	var input models.CourseInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Name == "" || input.Code == "" {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("CreateCourse Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "A course needs a name and a code")
+		return
+	}
+
+	// The creator of the course is its first instructor
+	course := models.Course{Name: input.Name, Code: input.Code, AccountID: userID}
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&course).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.Enrollment{CourseID: course.ID, AccountID: userID, Role: models.EnrollmentRoleInstructor}).Error
+	})
+	if err != nil {
+		err := errors.New("COURSE CREATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CreateCourse Endpoint:An error occured while creating a new course")
+		abortWithProblem(c, http.StatusBadRequest, "COURSE_CREATION_ERROR", "An error occured while creating a new course, the code may already be in use")
+		return
+	}
+
+	requestLogger(c).Info().Msg("CreateCourse Endpoint:Successfully created the course")
+
+	c.JSON(http.StatusCreated, newCourseResponse(course, models.EnrollmentRoleInstructor))
+}
+
+func getCourses(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getcourses_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetCourses Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetCourses Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	var enrollments []models.Enrollment
+	if err := requestDB(c).Preload("Course").Where("account_id = ?", userID).Find(&enrollments).Error; err != nil {
+		err := errors.New("COURSE RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetCourses Endpoint:Unable to retrieve courses from database")
+		abortWithProblem(c, http.StatusInternalServerError, "COURSE_RETRIEVAL_ERROR", "Unable to retrieve courses from database")
+		return
+	}
+
+	courseResponses := []models.CourseResponse{}
+	for _, enrollment := range enrollments {
+		if enrollment.Course.ID == 0 {
+			continue // course was deleted
+		}
+		courseResponses = append(courseResponses, newCourseResponse(enrollment.Course, enrollment.Role))
+	}
+
+	requestLogger(c).Info().Msg("GetCourses Endpoint:Successfully retrieved the courses")
+
+	c.JSON(http.StatusOK, courseResponses)
+}
+
+func getCourse(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getcourse_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetCourse Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetCourse Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	course, role, ok := findEnrolledCourse(c, "GetCourse", userID, false)
+	if !ok {
+		return
+	}
+
+	requestLogger(c).Info().Msg("GetCourse Endpoint:Successfully retrieved the course")
+
+	c.JSON(http.StatusOK, newCourseResponse(course, role))
+}
+
+func enrollAccount(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("enrollaccount_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("EnrollAccount Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("EnrollAccount Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	course, _, ok := findEnrolledCourse(c, "EnrollAccount", userID, true)
+	if !ok {
+		return
+	}
+
+	var input models.EnrollmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("EnrollAccount Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The request body is incorrect")
+		return
+	}
+
+	var enrollment models.Enrollment
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		enrollment, _, err = enroll(tx, course.ID, input.Email, input.Role)
+		return err
+	})
+	if err != nil {
+		requestLogger(c).Error().Err(err).Msg("EnrollAccount Endpoint:Failed to enroll the account")
+		abortWithProblem(c, http.StatusBadRequest, "ENROLLMENT_FAILED", err.Error())
+		return
+	}
+
+	requestLogger(c).Info().Msg("EnrollAccount Endpoint:Successfully enrolled the account")
+
+	c.JSON(http.StatusCreated, newEnrollmentResponse(enrollment, input.Email))
+}
+
+func getEnrollments(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getenrollments_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetEnrollments Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetEnrollments Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	course, _, ok := findEnrolledCourse(c, "GetEnrollments", userID, true)
+	if !ok {
+		return
+	}
+
+	var enrollments []models.Enrollment
+	if err := requestDB(c).Preload("Account").Where("course_id = ?", course.ID).Find(&enrollments).Error; err != nil {
+		err := errors.New("ENROLLMENT RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetEnrollments Endpoint:Unable to retrieve enrollments from database")
+		abortWithProblem(c, http.StatusInternalServerError, "ENROLLMENT_RETRIEVAL_ERROR", "Unable to retrieve enrollments from database")
+		return
+	}
+
+	enrollmentResponses := []models.EnrollmentResponse{}
+	for _, enrollment := range enrollments {
+		enrollmentResponses = append(enrollmentResponses, newEnrollmentResponse(enrollment, enrollment.Account.Email))
+	}
+
+	requestLogger(c).Info().Msg("GetEnrollments Endpoint:Successfully retrieved the enrollments")
+
+	c.JSON(http.StatusOK, enrollmentResponses)
+}
+
+func unenrollAccount(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("unenrollaccount_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("UnenrollAccount Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("UnenrollAccount Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	course, _, ok := findEnrolledCourse(c, "UnenrollAccount", userID, true)
+	if !ok {
+		return
+	}
+
+	enrollmentID, err := strconv.ParseUint(c.Param("enrollmentId"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID ENROLLMENT ID")
+		requestLogger(c).Error().Err(err).Msg("UnenrollAccount Endpoint:The enrollment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ENROLLMENT_ID", "Invalid enrollment ID")
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		var enrollment models.Enrollment
+		if err := tx.Where("id = ? AND course_id = ?", enrollmentID, course.ID).First(&enrollment).Error; err != nil {
+			return err
+		}
+		if err := keepInstructor(tx, enrollment); err != nil {
+			return err
+		}
+
+		return tx.Delete(&enrollment).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err := errors.New("ENROLLMENT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("UnenrollAccount Endpoint:The enrollment doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ENROLLMENT_NOT_FOUND", "Enrollment not found")
+		return
+	}
+	if errors.Is(err, errLastInstructor) {
+		requestLogger(c).Error().Err(err).Msg("UnenrollAccount Endpoint:The account is the last instructor of the course")
+		abortWithProblem(c, http.StatusConflict, "LAST_INSTRUCTOR", "The last instructor of a course can't be unenrolled")
+		return
+	}
+	if err != nil {
+		err := errors.New("DELETE ERROR")
+		requestLogger(c).Error().Err(err).Msg("UnenrollAccount Endpoint:Failed to delete the enrollment")
+		abortWithProblem(c, http.StatusInternalServerError, "DELETE_ERROR", "Failed to delete the enrollment")
+		return
+	}
+
+	requestLogger(c).Info().Msg("UnenrollAccount Endpoint:Successfully deleted the enrollment")
+
+	c.Status(http.StatusNoContent)
+}
+
+// importEnrollments enrolls every account of a CSV document with an "email"
+// column and an optional "role" column, sent either as the request body or
+// as the "file" field of a multipart form.
+func importEnrollments(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("importenrollments_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("ImportEnrollments Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("ImportEnrollments Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	course, _, ok := findEnrolledCourse(c, "ImportEnrollments", userID, true)
+	if !ok {
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			requestLogger(c).Error().Err(err).Msg("ImportEnrollments Endpoint:Unable to open the uploaded file")
+			abortWithProblem(c, http.StatusBadRequest, "INVALID_UPLOAD", "Unable to open the uploaded file")
+			return
+		}
+		defer opened.Close()
+		body = opened
+	}
+
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err != nil {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("ImportEnrollments Endpoint:Unable to read the header line")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The CSV document needs a header line")
+		return
+	}
+
+	emailColumn, roleColumn := -1, -1
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "email":
+			emailColumn = i
+		case "role":
+			roleColumn = i
+		}
+	}
+	if emailColumn < 0 {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("ImportEnrollments Endpoint:The email column is missing")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The CSV document needs an email column")
+		return
+	}
+
+	importResponse := models.EnrollmentImportResponse{Errors: []string{}}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			importResponse.Errors = append(importResponse.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		role := ""
+		if roleColumn >= 0 && roleColumn < len(record) {
+			role = strings.TrimSpace(record[roleColumn])
+		}
+
+		// Each line is applied on its own so a bad line doesn't block the others
+		var created bool
+		err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+			_, created, err = enroll(tx, course.ID, strings.TrimSpace(record[emailColumn]), role)
+			return err
+		})
+		if err != nil {
+			importResponse.Errors = append(importResponse.Errors, fmt.Sprintf("line %d: %v", line, err))
+		} else if created {
+			importResponse.Enrolled++
+		} else {
+			importResponse.Updated++
+		}
+	}
+
+	requestLogger(c).Info().Int("enrolled", importResponse.Enrolled).Int("errors", len(importResponse.Errors)).Msg("ImportEnrollments Endpoint:Imported the enrollments")
+
+	c.JSON(http.StatusOK, importResponse)
+}
+
+// enroll enrolls the account with the given email in the course, or changes
+// its role when it is already enrolled. The boolean reports a new enrollment.
+func enroll(tx *gorm.DB, courseID uint, email string, role string) (models.Enrollment, bool, error) {
+	var enrollment models.Enrollment
+
+	if role == "" {
+		role = models.EnrollmentRoleStudent
+	}
+	if role != models.EnrollmentRoleStudent && role != models.EnrollmentRoleInstructor {
+		return enrollment, false, errors.New("role should be either student or instructor")
+	}
+
+	var account models.Account
+	if err := tx.Where("email = ?", email).First(&account).Error; err != nil {
+		return enrollment, false, fmt.Errorf("account %q not found", email)
+	}
+
+	// An earlier enrollment of the account is revived
+	err := tx.Unscoped().Where("course_id = ? AND account_id = ?", courseID, account.ID).Limit(1).Find(&enrollment).Error
+	if err != nil {
+		return enrollment, false, err
+	}
+	created := enrollment.ID == 0 || enrollment.DeletedAt.Valid
+	if !created && role != models.EnrollmentRoleInstructor {
+		if err := keepInstructor(tx, enrollment); err != nil {
+			return enrollment, false, err
+		}
+	}
+
+	enrollment.CourseID = courseID
+	enrollment.AccountID = account.ID
+	enrollment.Role = role
+	enrollment.DeletedAt = gorm.DeletedAt{}
+
+	return enrollment, created, tx.Unscoped().Save(&enrollment).Error
+}
+
+// Returned by keepInstructor when the course would be left without instructor
+var errLastInstructor = errors.New("a course needs at least one instructor")
+
+// keepInstructor checks that the course keeps an instructor without the given
+// enrollment. The instructors are locked until the end of the transaction so
+// that two of them can't leave at once.
+func keepInstructor(tx *gorm.DB, enrollment models.Enrollment) error {
+	if enrollment.Role != models.EnrollmentRoleInstructor {
+		return nil
+	}
+
+	var instructors []models.Enrollment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("course_id = ? AND role = ?", enrollment.CourseID, models.EnrollmentRoleInstructor).
+		Find(&instructors).Error
+	if err != nil {
+		return err
+	}
+	for _, instructor := range instructors {
+		if instructor.ID != enrollment.ID {
+			return nil
+		}
+	}
+
+	return errLastInstructor
+}
+
+// enrollmentRole returns the role of the account in the course, or an empty
+// string when it isn't enrolled.
+func enrollmentRole(tx *gorm.DB, courseID uint, accountID uint) string {
+	var enrollment models.Enrollment
+	if err := tx.Where("course_id = ? AND account_id = ?", courseID, accountID).First(&enrollment).Error; err != nil {
+		return ""
+	}
+
+	return enrollment.Role
+}
+
+// findEnrolledCourse loads the course referenced by the id parameter and
+// checks that the account is enrolled in it, as an instructor if required.
+// When it isn't, the error response is written and false is returned.
+func findEnrolledCourse(c *gin.Context, endpoint string, userID uint, instructorOnly bool) (models.Course, string, bool) {
+	var course models.Course
+
+	courseID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID COURSE ID")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The course ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_COURSE_ID", "Invalid course ID")
+		return course, "", false
+	}
+
+	// Courses the account isn't enrolled in are reported as missing
+	role := enrollmentRole(requestDB(c), uint(courseID), userID)
+	if role == "" || requestDB(c).First(&course, courseID).Error != nil {
+		err := errors.New("COURSE NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The course doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "COURSE_NOT_FOUND", "Course not found")
+		return course, "", false
+	}
+
+	if instructorOnly && role != models.EnrollmentRoleInstructor {
+		err := errors.New("AUTHORIZATION ERROR")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The user is not an instructor of this course")
+		abortWithProblem(c, http.StatusForbidden, "AUTHORIZATION_ERROR", "You are not an instructor of this course")
+		return course, role, false
+	}
+
+	return course, role, true
+}
+
+// visibleAssignments scopes a query to the assignments the account can see:
+// its own, every assignment of the courses it teaches, the published ones of
+// the courses it attends, and published ones created before courses existed,
+// which have no course. New assignments can't be created without a course.
+func visibleAssignments(query *gorm.DB, userID uint) *gorm.DB {
+	subquery := query.Session(&gorm.Session{NewDB: true})
+	enrolled := subquery.Model(&models.Enrollment{}).Select("course_id").Where("account_id = ?", userID)
+	teaching := subquery.Model(&models.Enrollment{}).Select("course_id").Where("account_id = ? AND role = ?", userID, models.EnrollmentRoleInstructor)
+
+	return query.Where(
+		subquery.Where("assignments.account_id = ?", userID).
+			Or("assignments.course_id IN (?)", teaching).
+			Or("assignments.status = ? AND assignments.course_id IN (?)", models.AssignmentStatusPublished, enrolled).
+			Or("assignments.status = ? AND assignments.course_id IS NULL", models.AssignmentStatusPublished),
+	)
+}
+
+// canViewAssignment applies the rules of visibleAssignments to a single assignment
+func canViewAssignment(tx *gorm.DB, assignment models.Assignment, userID uint) bool {
+	if assignment.AccountID == userID {
+		return true
+	}
+
+	published := assignment.Status == models.AssignmentStatusPublished
+	if assignment.CourseID == nil {
+		return published
+	}
+
+	role := enrollmentRole(tx, *assignment.CourseID, userID)
+	return role == models.EnrollmentRoleInstructor || (role != "" && published)
+}
+
+func newCourseResponse(course models.Course, role string) models.CourseResponse {
+	return models.CourseResponse{
+		ID:      course.ID,
+		Name:    course.Name,
+		Code:    course.Code,
+		Role:    role,
+		Created: course.CreatedAt.String(),
+	}
+}
+
+func newEnrollmentResponse(enrollment models.Enrollment, email string) models.EnrollmentResponse {
+	return models.EnrollmentResponse{
+		ID:        enrollment.ID,
+		CourseID:  enrollment.CourseID,
+		AccountID: enrollment.AccountID,
+		Email:     email,
+		Role:      enrollment.Role,
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCourses(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+
+	w := testRequest(router, http.MethodPost, "/v1/courses", owner.Email, models.CourseInput{Name: "Cloud Computing", Code: "CSYE6225"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var course models.CourseResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &course))
+	assert.Equal(t, models.EnrollmentRoleInstructor, course.Role)
+	path := "/v1/courses/" + strconv.FormatUint(uint64(course.ID), 10)
+
+	// Codes are unique
+	w = testRequest(router, http.MethodPost, "/v1/courses", ada.Email, models.CourseInput{Name: "Another", Code: "CSYE6225"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Courses the account isn't enrolled in are missing
+	w = testRequest(router, http.MethodGet, path, ada.Email, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = testRequest(router, http.MethodGet, "/v1/courses", ada.Email, nil)
+	assert.Equal(t, "[]", w.Body.String())
+
+	w = testRequest(router, http.MethodGet, "/v1/courses", owner.Email, nil)
+	var courses []models.CourseResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &courses))
+	require.Len(t, courses, 1)
+	assert.Equal(t, course.ID, courses[0].ID)
+}
+
+func TestEnrollments(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	bob := testAccount(t, "bob@example.com")
+	course := models.Course{Name: "Cloud Computing", Code: "CSYE6225", AccountID: owner.ID}
+	require.NoError(t, db.Create(&course).Error)
+	instructor := models.Enrollment{CourseID: course.ID, AccountID: owner.ID, Role: models.EnrollmentRoleInstructor}
+	require.NoError(t, db.Create(&instructor).Error)
+	path := "/v1/courses/" + strconv.FormatUint(uint64(course.ID), 10) + "/enrollments"
+
+	enroll := func(email string, input models.EnrollmentInput) (int, models.EnrollmentResponse) {
+		t.Helper()
+		w := testRequest(router, http.MethodPost, path, email, input)
+		var enrollment models.EnrollmentResponse
+		json.Unmarshal(w.Body.Bytes(), &enrollment)
+		return w.Code, enrollment
+	}
+	unenroll := func(email string, enrollmentID uint) int {
+		return testRequest(router, http.MethodDelete, path+"/"+strconv.FormatUint(uint64(enrollmentID), 10), email, nil).Code
+	}
+
+	status, student := enroll(owner.Email, models.EnrollmentInput{Email: ada.Email})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, models.EnrollmentRoleStudent, student.Role)
+
+	// Students don't manage the enrollments
+	status, _ = enroll(ada.Email, models.EnrollmentInput{Email: bob.Email})
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, http.StatusForbidden, unenroll(ada.Email, instructor.ID))
+
+	status, _ = enroll(owner.Email, models.EnrollmentInput{Email: "nobody@example.com"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = enroll(owner.Email, models.EnrollmentInput{Email: bob.Email, Role: "assistant"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// The last instructor can neither leave nor become a student
+	assert.Equal(t, http.StatusConflict, unenroll(owner.Email, instructor.ID))
+	status, _ = enroll(owner.Email, models.EnrollmentInput{Email: owner.Email, Role: models.EnrollmentRoleStudent})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Enrolling again changes the role of the same enrollment
+	status, promoted := enroll(owner.Email, models.EnrollmentInput{Email: ada.Email, Role: models.EnrollmentRoleInstructor})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, student.ID, promoted.ID)
+	assert.Equal(t, http.StatusNoContent, unenroll(ada.Email, instructor.ID))
+	assert.Equal(t, http.StatusNotFound, unenroll(ada.Email, instructor.ID))
+
+	// Unenrolled accounts are enrolled again with their former enrollment
+	status, revived := enroll(ada.Email, models.EnrollmentInput{Email: owner.Email, Role: models.EnrollmentRoleInstructor})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, instructor.ID, revived.ID)
+	var count int64
+	require.NoError(t, db.Unscoped().Model(&models.Enrollment{}).Where("course_id = ?", course.ID).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	w := testRequest(router, http.MethodPost, path+"/import", owner.Email, "email,role\nbob@example.com,student\nada@example.com,instructor\nnobody@example.com,student\n")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var imported models.EnrollmentImportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imported))
+	assert.Equal(t, 1, imported.Enrolled)
+	assert.Equal(t, 1, imported.Updated)
+	assert.Len(t, imported.Errors, 1)
+
+	w = testRequest(router, http.MethodGet, path, owner.Email, nil)
+	var enrollments []models.EnrollmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollments))
+	assert.Len(t, enrollments, 3)
+}
+
+func TestCourseAssignments(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	outsider := testAccount(t, "outsider@example.com")
+	course := models.Course{Name: "Cloud Computing", Code: "CSYE6225", AccountID: owner.ID}
+	require.NoError(t, db.Create(&course).Error)
+	require.NoError(t, db.Create(&[]models.Enrollment{
+		{CourseID: course.ID, AccountID: owner.ID, Role: models.EnrollmentRoleInstructor},
+		{CourseID: course.ID, AccountID: ada.ID, Role: models.EnrollmentRoleStudent},
+	}).Error)
+
+	input := models.AssignmentInput{Name: "Lab 1", Points: 10, NoOfAttempts: 3, Deadline: "2099-01-10T23:59:00.000Z"}
+
+	// New assignments belong to a course the account teaches
+	w := testRequest(router, http.MethodPost, "/v1/assignments", owner.Email, input)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "COURSE_REQUIRED")
+	input.CourseID = course.ID
+	w = testRequest(router, http.MethodPost, "/v1/assignments", ada.Email, input)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = testRequest(router, http.MethodPost, "/v1/assignments", owner.Email, input)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var draft models.AssignmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &draft))
+
+	published := testAssignment(t, owner, func(assignment *models.Assignment) { assignment.CourseID = &course.ID })
+	legacy := testAssignment(t, owner, nil)
+
+	for _, test := range []struct {
+		account    models.Account
+		assignment uint
+		visible    bool
+	}{
+		{owner, draft.ID, true},
+		{ada, draft.ID, false},
+		{ada, published.ID, true},
+		{outsider, published.ID, false},
+		{ada, legacy.ID, true},
+		{outsider, legacy.ID, true},
+	} {
+		w := testRequest(router, http.MethodGet, "/v1/assignments/"+strconv.FormatUint(uint64(test.assignment), 10), test.account.Email, nil)
+		assert.Equal(t, test.visible, w.Code == http.StatusOK, "assignment %d for %s", test.assignment, test.account.Email)
+	}
+
+	var visible []uint
+	require.NoError(t, visibleAssignments(db.Model(&models.Assignment{}), outsider.ID).Order("id").Pluck("id", &visible).Error)
+	assert.Equal(t, []uint{legacy.ID}, visible)
+	require.NoError(t, visibleAssignments(db.Model(&models.Assignment{}), ada.ID).Order("id").Pluck("id", &visible).Error)
+	assert.Equal(t, []uint{published.ID, legacy.ID}, visible)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/rs/zerolog/log"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// Idle connections kept by the pool, the default of database/sql
+const dbMaxIdleConns = 2
+
+// Error MySQL answers to credentials it doesn't accept
+const mysqlAccessDenied = 1045
+
+// Error MySQL answers to a row breaking a unique index
+const mysqlDuplicateEntry = 1062
+
+// mysqlConfig returns the settings of the MySQL driver for the credentials,
+// connecting to the server alone when the database may not exist yet.
+func (c databaseConfig) mysqlConfig(user string, password string, withDatabase bool) *mysqldriver.Config {
+	config := mysqldriver.NewConfig()
+	config.User = user
+	config.Passwd = password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	if withDatabase {
+		config.DBName = c.Name
+	}
+	config.ParseTime = true
+	config.Loc = time.Local
+	return config
+}
+
+// credentialConnector opens the connections of a pool with the credentials
+// of the database as last resolved, so that rotated credentials are used
+// without opening another pool.
+type credentialConnector struct {
+	config       databaseConfig
+	withDatabase bool
+	secrets      secretResolver
+
+	mu          sync.RWMutex
+	credentials *mysqldriver.Config
+	connector   driver.Connector
+}
+
+func newCredentialConnector(ctx context.Context, config databaseConfig, withDatabase bool, secrets secretResolver) (*credentialConnector, error) {
+	c := &credentialConnector{config: config, withDatabase: withDatabase, secrets: secrets}
+	if _, err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// refresh resolves the credentials again, telling whether they changed
+func (c *credentialConnector) refresh(ctx context.Context) (bool, error) {
+	user, err := c.secrets.resolve(ctx, c.config.User)
+	if err != nil {
+		return false, err
+	}
+	password, err := c.secrets.resolve(ctx, c.config.Password)
+	if err != nil {
+		return false, err
+	}
+
+	credentials := c.config.mysqlConfig(user, password, c.withDatabase)
+	connector, err := mysqldriver.NewConnector(credentials)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := c.credentials != nil && (c.credentials.User != user || c.credentials.Passwd != password)
+	c.credentials, c.connector = credentials, connector
+	return changed, nil
+}
+
+func (c *credentialConnector) current() driver.Connector {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connector
+}
+
+// Connect opens a connection, resolving the credentials again when MySQL
+// turns them down as they may have been rotated since the last refresh.
+func (c *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.current().Connect(ctx)
+
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlAccessDenied {
+		if changed, refreshErr := c.refresh(ctx); refreshErr == nil && changed {
+			log.Info().Msg("Database credentials were rotated, connecting with the new ones")
+			return c.current().Connect(ctx)
+		}
+	}
+	return conn, err
+}
+
+// isDuplicateEntry reports whether the statement broke a unique index
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+func (c *credentialConnector) Driver() driver.Driver {
+	return mysqldriver.MySQLDriver{}
+}
+
+// openDatabase opens a pool of connections to the database, or to the
+// server alone when it may not exist yet. As with gorm.Open, the handle is
+// returned along with an error when the database doesn't answer.
+func openDatabase(ctx context.Context, config databaseConfig, withDatabase bool, secrets secretResolver) (*gorm.DB, *credentialConnector, error) {
+	connector, err := newCredentialConnector(ctx, config, withDatabase, secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlDB := sql.OpenDB(connector)
+	sqlDB.SetMaxIdleConns(dbMaxIdleConns)
+
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB}), &gorm.Config{Logger: gormLogger})
+	return gormDB, connector, err
+}
+
+// refreshCredentials resolves the credentials of the pool every interval
+// until the context is cancelled. Once they change, the idle connections,
+// opened with the previous ones, are closed so the pool reconnects. The
+// connections in use then are retired once they outlive the interval.
+func refreshCredentials(ctx context.Context, sqlDB *sql.DB, connector *credentialConnector, interval time.Duration) {
+	sqlDB.SetConnMaxLifetime(interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := connector.refresh(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Unable to refresh the database credentials, keeping the current ones")
+				continue
+			}
+			if changed {
+				log.Info().Msg("Database credentials were rotated, reconnecting the pool")
+				sqlDB.SetMaxIdleConns(0)
+				sqlDB.SetMaxIdleConns(dbMaxIdleConns)
+			}
+		}
+	}
+}
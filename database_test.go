@@ -0,0 +1,128 @@
+package main
+
+import (
+	"app/assignment/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// testDatabase points the handlers at the MySQL database given by the DB_*
+// variables, as the integration test workflow does, with empty tables. The
+// test is skipped when DB_HOST isn't set.
+func testDatabase(t *testing.T) {
+	t.Helper()
+
+	if os.Getenv("DB_HOST") == "" {
+		t.Skip("DB_HOST is not set, this test needs MySQL")
+	}
+	port := 3306
+	if value := os.Getenv("DB_PORT"); value != "" {
+		var err error
+		port, err = strconv.Atoi(value)
+		require.NoError(t, err)
+	}
+	config := databaseConfig{
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PASSWORD"),
+		Host:     os.Getenv("DB_HOST"),
+		Port:     port,
+		Name:     os.Getenv("DB_NAME"),
+	}
+
+	testDB, _, err := openDatabase(context.Background(), config, true, secretResolver{})
+	require.NoError(t, err)
+	require.NoError(t, testDB.AutoMigrate(migratedModels...))
+
+	// Rows of the previous tests reference each other
+	err = testDB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return err
+		}
+		for _, model := range migratedModels {
+			if err := conn.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return conn.Exec("SET FOREIGN_KEY_CHECKS = 1").Error
+	})
+	require.NoError(t, err)
+
+	previousDB := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previousDB
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// testAccount creates an account whose password is its email
+func testAccount(t *testing.T, email string) models.Account {
+	t.Helper()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(email), bcrypt.MinCost)
+	require.NoError(t, err)
+	name, _, _ := strings.Cut(email, "@")
+	account := models.Account{Firstname: name, LastName: name, Email: email, Password: string(hashedPassword)}
+	require.NoError(t, db.Create(&account).Error)
+	return account
+}
+
+// testAssignment creates a published assignment of the owner, applying the
+// given changes first.
+func testAssignment(t *testing.T, owner models.Account, changes func(*models.Assignment)) models.Assignment {
+	t.Helper()
+
+	assignment := models.Assignment{
+		Name:         "Lab 1",
+		Points:       10,
+		NoOfAttempts: 3,
+		Deadline:     "2099-01-10T23:59:00.000Z",
+		AccountID:    owner.ID,
+		LatePolicy:   models.LatePolicyHardCutoff,
+		Status:       models.AssignmentStatusPublished,
+	}
+	if changes != nil {
+		changes(&assignment)
+	}
+	require.NoError(t, db.Create(&assignment).Error)
+	return assignment
+}
+
+// testRequest sends a request to the router on behalf of the account with
+// the given email, with the body encoded as JSON unless it is a string.
+func testRequest(router http.Handler, method string, path string, email string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	default:
+		encoded, _ := json.Marshal(body)
+		reader = bytes.NewReader(encoded)
+	}
+
+	request := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		request.Header.Set("Content-Type", gin.MIMEJSON)
+	}
+	request.SetBasicAuth(email, email)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
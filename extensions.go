@@ -0,0 +1,263 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func grantExtension(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("grantextension_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GrantExtension Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "GrantExtension", userID)
+	if !ok {
+		return
+	}
+
+	var input models.ExtensionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The request body is incorrect")
+		return
+	}
+
+	// An extension has to move the deadline, add attempts, or both
+	if input.Deadline == "" && input.ExtraAttempts == 0 {
+		err := errors.New("EMPTY EXTENSION")
+		requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:The extension grants nothing")
+		abortWithProblem(c, http.StatusBadRequest, "EMPTY_EXTENSION", "An extension needs a deadline and/or extra attempts")
+		return
+	}
+	if input.Deadline != "" {
+		extended, err := time.Parse(deadlineLayout, input.Deadline)
+		if err != nil {
+			err := errors.New("DEADLINE PARSE ERROR")
+			requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:The deadline is invalid")
+			abortWithProblem(c, http.StatusBadRequest, "DEADLINE_PARSE_ERROR", "deadline should be in the format "+deadlineLayout)
+			return
+		}
+		if deadline, err := time.Parse(deadlineLayout, assignment.Deadline); err == nil && extended.Before(deadline) {
+			err := errors.New("EXTENSION DEADLINE ERROR")
+			requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:The extension deadline is earlier than the deadline of the assignment")
+			abortWithProblem(c, http.StatusBadRequest, "EXTENSION_DEADLINE_ERROR", "The extension deadline can't be earlier than the deadline of the assignment")
+			return
+		}
+	}
+	if input.ExtraAttempts < 0 || input.ExtraAttempts > 100 {
+		err := errors.New("NUMBER OF ATTEMPTS ERROR")
+		requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:Extra attempts should be between 0 and 100")
+		abortWithProblem(c, http.StatusBadRequest, "NUMBER_OF_ATTEMPTS_ERROR", "Extra attempts should be between 0 and 100")
+		return
+	}
+
+	var student models.Account
+	if err := requestDB(c).Where("email = ?", input.Email).First(&student).Error; err != nil {
+		err := errors.New("ACCOUNT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:The account doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ACCOUNT_NOT_FOUND", "Account not found")
+		return
+	}
+
+	// A new grant replaces any previous extension of the student, revoked
+	// ones included, locking it against a concurrent grant
+	var extension models.Extension
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("assignment_id = ? AND account_id = ?", assignment.ID, student.ID).
+			Limit(1).Find(&extension).Error
+		if err != nil {
+			return err
+		}
+
+		extension.AssignmentID = assignment.ID
+		extension.AccountID = student.ID
+		extension.Deadline = input.Deadline
+		extension.ExtraAttempts = input.ExtraAttempts
+		extension.GrantedByID = userID
+		extension.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Save(&extension).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "extension.grant", "extension", extension.ID, input)
+	})
+	if err != nil {
+		err := errors.New("EXTENSION GRANT ERROR")
+		requestLogger(c).Error().Err(err).Msg("GrantExtension Endpoint:Failed to grant the extension")
+		abortWithProblem(c, http.StatusInternalServerError, "EXTENSION_GRANT_ERROR", "Failed to grant the extension")
+		return
+	}
+
+	requestLogger(c).Info().Msg("GrantExtension Endpoint:Successfully granted the extension")
+
+	c.JSON(http.StatusCreated, newExtensionResponse(extension, student.Email))
+}
+
+func getExtensions(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getextensions_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetExtensions Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetExtensions Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "GetExtensions", userID)
+	if !ok {
+		return
+	}
+
+	var extensions []models.Extension
+	if err := requestDB(c).Preload("Account").Where("assignment_id = ?", assignment.ID).Find(&extensions).Error; err != nil {
+		err := errors.New("EXTENSION RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetExtensions Endpoint:Unable to retrieve extensions from database")
+		abortWithProblem(c, http.StatusInternalServerError, "EXTENSION_RETRIEVAL_ERROR", "Unable to retrieve extensions from database")
+		return
+	}
+
+	extensionResponses := []models.ExtensionResponse{}
+	for _, extension := range extensions {
+		extensionResponses = append(extensionResponses, newExtensionResponse(extension, extension.Account.Email))
+	}
+
+	requestLogger(c).Info().Msg("GetExtensions Endpoint:Successfully retrieved the extensions")
+
+	c.JSON(http.StatusOK, extensionResponses)
+}
+
+func revokeExtension(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("revokeextension_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("RevokeExtension Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("RevokeExtension Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "RevokeExtension", userID)
+	if !ok {
+		return
+	}
+
+	extensionID, err := strconv.ParseUint(c.Param("extensionId"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID EXTENSION ID")
+		requestLogger(c).Error().Err(err).Msg("RevokeExtension Endpoint:The extension ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_EXTENSION_ID", "Invalid extension ID")
+		return
+	}
+
+	var extension models.Extension
+	if err := requestDB(c).Where("id = ? AND assignment_id = ?", extensionID, assignment.ID).First(&extension).Error; err != nil {
+		err := errors.New("EXTENSION NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("RevokeExtension Endpoint:The extension doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "EXTENSION_NOT_FOUND", "Extension not found")
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&extension).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "extension.revoke", "extension", extension.ID, gin.H{"account_id": extension.AccountID})
+	})
+	if err != nil {
+		err := errors.New("DELETE ERROR")
+		requestLogger(c).Error().Err(err).Msg("RevokeExtension Endpoint:Failed to revoke the extension")
+		abortWithProblem(c, http.StatusInternalServerError, "DELETE_ERROR", "Failed to revoke the extension")
+		return
+	}
+
+	requestLogger(c).Info().Msg("RevokeExtension Endpoint:Successfully revoked the extension")
+
+	c.Status(http.StatusNoContent)
+}
+
+func newExtensionResponse(extension models.Extension, email string) models.ExtensionResponse {
+	return models.ExtensionResponse{
+		ID:            extension.ID,
+		AssignmentID:  extension.AssignmentID,
+		AccountID:     extension.AccountID,
+		Email:         email,
+		Deadline:      extension.Deadline,
+		ExtraAttempts: extension.ExtraAttempts,
+		GrantedBy:     extension.GrantedByID,
+		Granted:       extension.UpdatedAt.String(),
+	}
+}
+
+// effectiveAssignment applies the extension granted to the given account, if
+// any, returning the assignment as that student sees it: their own deadline,
+// late-until date shifted by the same amount, and attempt limit.
+func effectiveAssignment(tx *gorm.DB, assignment models.Assignment, accountID uint) (models.Assignment, error) {
+	var extension models.Extension
+	err := tx.Where("assignment_id = ? AND account_id = ?", assignment.ID, accountID).First(&extension).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return assignment, nil
+	}
+	if err != nil {
+		return assignment, err
+	}
+
+	assignment.NoOfAttempts += extension.ExtraAttempts
+
+	if extension.Deadline != "" {
+		deadline, errDeadline := time.Parse(deadlineLayout, assignment.Deadline)
+		extended, errExtended := time.Parse(deadlineLayout, extension.Deadline)
+		lateUntil, errLateUntil := time.Parse(deadlineLayout, assignment.LateUntil)
+		if errDeadline == nil && errExtended == nil && errLateUntil == nil {
+			assignment.LateUntil = lateUntil.Add(extended.Sub(deadline)).Format(deadlineLayout)
+		}
+		assignment.Deadline = extension.Deadline
+	}
+
+	return assignment, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtensions(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	assignment := testAssignment(t, owner, func(assignment *models.Assignment) {
+		assignment.LatePolicy = models.LatePolicyLateUntil
+		assignment.LateUntil = "2099-01-12T23:59:00.000Z"
+	})
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/extensions"
+
+	grant := func(input models.ExtensionInput) models.ExtensionResponse {
+		t.Helper()
+		w := testRequest(router, http.MethodPost, path, owner.Email, input)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var extension models.ExtensionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &extension))
+		return extension
+	}
+
+	// The deadline can only move later
+	w := testRequest(router, http.MethodPost, path, owner.Email, models.ExtensionInput{Email: ada.Email, Deadline: "2099-01-09T23:59:00.000Z"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "EXTENSION_DEADLINE_ERROR")
+
+	// Only the owner grants extensions
+	w = testRequest(router, http.MethodPost, path, ada.Email, models.ExtensionInput{Email: ada.Email, ExtraAttempts: 1})
+	assert.NotEqual(t, http.StatusCreated, w.Code)
+
+	first := grant(models.ExtensionInput{Email: ada.Email, Deadline: "2099-01-11T23:59:00.000Z"})
+	assert.Equal(t, ada.ID, first.AccountID)
+
+	// A new grant replaces the extension
+	second := grant(models.ExtensionInput{Email: ada.Email, ExtraAttempts: 2})
+	assert.Equal(t, first.ID, second.ID)
+	assert.Empty(t, second.Deadline)
+	var count int64
+	require.NoError(t, db.Model(&models.Extension{}).Where("assignment_id = ?", assignment.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	w = testRequest(router, http.MethodGet, path, owner.Email, nil)
+	var extensions []models.ExtensionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &extensions))
+	require.Len(t, extensions, 1)
+	assert.Equal(t, ada.Email, extensions[0].Email)
+	assert.Equal(t, 2, extensions[0].ExtraAttempts)
+
+	// A revoked extension no longer applies
+	revoke := path + "/" + strconv.FormatUint(uint64(second.ID), 10)
+	w = testRequest(router, http.MethodDelete, revoke, owner.Email, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = testRequest(router, http.MethodDelete, revoke, owner.Email, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	effective, err := effectiveAssignment(db, assignment, ada.ID)
+	require.NoError(t, err)
+	assert.Equal(t, assignment, effective)
+
+	// and is revived by the next grant
+	third := grant(models.ExtensionInput{Email: ada.Email, Deadline: "2099-01-11T23:59:00.000Z", ExtraAttempts: 1})
+	assert.Equal(t, first.ID, third.ID)
+}
+
+func TestEffectiveAssignment(t *testing.T) {
+
+	testDatabase(t)
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	bob := testAccount(t, "bob@example.com")
+	assignment := testAssignment(t, owner, func(assignment *models.Assignment) {
+		assignment.LatePolicy = models.LatePolicyLateUntil
+		assignment.LateUntil = "2099-01-12T23:59:00.000Z"
+	})
+	require.NoError(t, db.Create(&models.Extension{AssignmentID: assignment.ID, AccountID: ada.ID, Deadline: "2099-01-11T11:59:00.000Z", ExtraAttempts: 2, GrantedByID: owner.ID}).Error)
+
+	// The late-until date moves with the deadline
+	effective, err := effectiveAssignment(db, assignment, ada.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2099-01-11T11:59:00.000Z", effective.Deadline)
+	assert.Equal(t, "2099-01-13T11:59:00Z", effective.LateUntil)
+	assert.Equal(t, 5, effective.NoOfAttempts)
+
+	// Students without an extension see the assignment as it is
+	effective, err = effectiveAssignment(db, assignment, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, assignment, effective)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const mimeCSV = "text/csv"
+
+// Rows of the gradebook whose rubric scores are loaded at once
+const gradebookBatchSize = 500
+
+// Header row of the CSV gradebook export
+var gradebookCSVHeader = []string{
+	"account_id", "firstname", "lastname", "email",
+	"assignment_id", "assignment_name", "attempts", "latest_submission", "late", "late_penalty", "score", "rubric_scores",
+}
+
+func getAssignmentGradebook(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getassignmentgradebook_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetAssignmentGradebook Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetAssignmentGradebook Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "GetAssignmentGradebook", userID)
+	if !ok {
+		return
+	}
+
+	streamGradebook(c, gradebookQuery(requestDB(c), userID).Where("assignments.id = ?", assignment.ID), "gradebook-assignment-"+strconv.FormatUint(uint64(assignment.ID), 10))
+}
+
+func getGradebook(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getgradebook_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetGradebook Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetGradebook Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	streamGradebook(c, gradebookQuery(requestDB(c), userID), "gradebook")
+}
+
+// gradebookRoster lists the students of every assignment of an owner: those
+// enrolled in its course, and those who submitted it, which covers
+// assignments without a course and students who left the course since.
+const gradebookRoster = `SELECT assignments.id AS assignment_id, enrollments.account_id
+	FROM assignments
+	JOIN enrollments ON enrollments.course_id = assignments.course_id AND enrollments.role = ? AND enrollments.deleted_at IS NULL
+	WHERE assignments.account_id = ? AND assignments.deleted_at IS NULL
+	UNION
+	SELECT assignments.id, COALESCE(team_members.account_id, submissions.account_id)
+	FROM submissions
+	JOIN assignments ON assignments.id = submissions.assignment_id
+	LEFT JOIN team_members ON team_members.team_id = submissions.team_id AND team_members.deleted_at IS NULL
+	WHERE assignments.account_id = ? AND assignments.deleted_at IS NULL AND submissions.deleted_at IS NULL`
+
+// gradebookQuery lists every student of the assignments owned by the given
+// account along with their submission, if any. Members of a team share the
+// submission of their team.
+func gradebookQuery(tx *gorm.DB, ownerID uint) *gorm.DB {
+	return tx.Table("assignments").
+		Select(`accounts.id AS account_id, accounts.firstname, accounts.last_name, accounts.email,
+			assignments.id AS assignment_id, assignments.name AS assignment_name,
+			COALESCE(submissions.id, 0) AS submission_id, COALESCE(submissions.submission_retries, 0) AS submission_retries,
+			submissions.updated_at, COALESCE(submissions.is_late, FALSE) AS is_late, COALESCE(submissions.late_penalty, 0) AS late_penalty, submissions.score`).
+		Joins("JOIN ("+gradebookRoster+") AS roster ON roster.assignment_id = assignments.id", models.EnrollmentRoleStudent, ownerID, ownerID).
+		Joins("JOIN accounts ON accounts.id = roster.account_id AND accounts.deleted_at IS NULL").
+		Joins("LEFT JOIN team_members ON team_members.assignment_id = assignments.id AND team_members.account_id = accounts.id AND team_members.deleted_at IS NULL").
+		Joins(`LEFT JOIN submissions ON submissions.assignment_id = assignments.id AND submissions.deleted_at IS NULL AND
+			(submissions.team_id = team_members.team_id OR (team_members.team_id IS NULL AND submissions.team_id IS NULL AND submissions.account_id = accounts.id))`).
+		Where("assignments.deleted_at IS NULL AND assignments.account_id = ?", ownerID).
+		Order("accounts.last_name, accounts.firstname, assignments.id")
+}
+
+// Row scanned from the gradebook query
+type gradebookRow struct {
+	AccountID         uint
+	Firstname         string
+	LastName          string
+	Email             string
+	AssignmentID      uint
+	AssignmentName    string
+	SubmissionID      uint // 0 when the student hasn't submitted
+	SubmissionRetries int
+	UpdatedAt         *time.Time
+	IsLate            bool
+	LatePenalty       float64
+	Score             *float64
+}
+
+func (r gradebookRow) entry(rubricScores []models.RubricScore) models.GradebookEntry {
+	if rubricScores == nil {
+		rubricScores = []models.RubricScore{}
+	}
+
+	latestSubmission := ""
+	if r.UpdatedAt != nil {
+		latestSubmission = r.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	return models.GradebookEntry{
+		AccountID:        r.AccountID,
+		Firstname:        r.Firstname,
+		LastName:         r.LastName,
+		Email:            r.Email,
+		AssignmentID:     r.AssignmentID,
+		AssignmentName:   r.AssignmentName,
+		Attempts:         r.SubmissionRetries,
+		LatestSubmission: latestSubmission,
+		Late:             r.IsLate,
+		LatePenalty:      r.LatePenalty,
+		Score:            r.Score,
+		RubricScores:     rubricScores,
+	}
+}
+
+// gradebookCSVRecord flattens a gradebook entry into a CSV record matching gradebookCSVHeader
+func gradebookCSVRecord(entry models.GradebookEntry) []string {
+	score := ""
+	if entry.Score != nil {
+		score = strconv.FormatFloat(*entry.Score, 'f', -1, 64)
+	}
+
+	rubric := []string{}
+	for _, rubricScore := range entry.RubricScores {
+		rubric = append(rubric, rubricScore.Criterion+"="+strconv.FormatFloat(rubricScore.Points, 'f', -1, 64))
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(entry.AccountID), 10),
+		entry.Firstname,
+		entry.LastName,
+		entry.Email,
+		strconv.FormatUint(uint64(entry.AssignmentID), 10),
+		entry.AssignmentName,
+		strconv.Itoa(entry.Attempts),
+		entry.LatestSubmission,
+		strconv.FormatBool(entry.Late),
+		strconv.FormatFloat(entry.LatePenalty, 'f', -1, 64),
+		score,
+		strings.Join(rubric, ";"),
+	}
+}
+
+// streamGradebook writes the rows of the given query in the format negotiated
+// from the Accept header, a batch at a time, so large courses are never
+// buffered whole.
+func streamGradebook(c *gin.Context, query *gorm.DB, filename string) {
+	format := c.NegotiateFormat(gin.MIMEJSON, mimeCSV)
+	if format == "" {
+		err := errors.New("UNSUPPORTED FORMAT")
+		requestLogger(c).Error().Err(err).Msg("Gradebook Endpoint:The requested format is not supported")
+		abortWithProblem(c, http.StatusNotAcceptable, "UNSUPPORTED_FORMAT", "Gradebook is available as application/json or text/csv")
+		return
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		err := errors.New("GRADEBOOK RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("Gradebook Endpoint:Unable to retrieve the gradebook from database")
+		abortWithProblem(c, http.StatusInternalServerError, "GRADEBOOK_RETRIEVAL_ERROR", "Unable to retrieve the gradebook from database")
+		return
+	}
+	defer rows.Close()
+
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(c.Writer)
+	if format == mimeCSV {
+		c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		c.Status(http.StatusOK)
+		csvWriter = csv.NewWriter(c.Writer)
+		csvWriter.Write(gradebookCSVHeader)
+	} else {
+		c.Header("Content-Type", gin.MIMEJSON+"; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("[")
+	}
+
+	// Rows are written in batches, the rubric scores of a batch being loaded
+	// with a single query
+	count := 0
+	batch := make([]gradebookRow, 0, gradebookBatchSize)
+	writeBatch := func() error {
+		submissionIDs := []uint{}
+		for _, row := range batch {
+			if row.SubmissionID != 0 {
+				submissionIDs = append(submissionIDs, row.SubmissionID)
+			}
+		}
+		scores, err := rubricScores(requestDB(c), submissionIDs)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range batch {
+			if csvWriter != nil {
+				csvWriter.Write(gradebookCSVRecord(row.entry(scores[row.SubmissionID])))
+			} else {
+				if count > 0 {
+					c.Writer.WriteString(",")
+				}
+				encoder.Encode(row.entry(scores[row.SubmissionID]))
+			}
+			count++
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+		c.Writer.Flush()
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		var row gradebookRow
+		if err = requestDB(c).ScanRows(rows, &row); err != nil {
+			break
+		}
+		batch = append(batch, row)
+		if len(batch) == gradebookBatchSize {
+			if err = writeBatch(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = writeBatch()
+	}
+	if err != nil {
+		requestLogger(c).Error().Err(err).Int("rows", count).Msg("Gradebook Endpoint:Unable to read the gradebook rows, the export is incomplete")
+		abortGradebook(c, csvWriter)
+		return
+	}
+
+	if csvWriter == nil {
+		c.Writer.WriteString("]")
+	}
+
+	requestLogger(c).Info().Int("rows", count).Msg("Gradebook Endpoint:Successfully streamed the gradebook")
+}
+
+// abortGradebook marks a gradebook that failed halfway as incomplete, as its
+// status is already sent: CSV ends with an error record, and the JSON array
+// is left open so that it can't be parsed as a complete document.
+func abortGradebook(c *gin.Context, csvWriter *csv.Writer) {
+	if csvWriter != nil {
+		csvWriter.Write([]string{"error", "the gradebook is incomplete, it couldn't be read from the database"})
+		csvWriter.Flush()
+	}
+	c.Writer.Flush()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGradebook(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	bob := testAccount(t, "bob@example.com")
+	course := models.Course{Name: "Cloud Computing", Code: "CSYE6225", AccountID: owner.ID}
+	require.NoError(t, db.Create(&course).Error)
+	require.NoError(t, db.Create(&[]models.Enrollment{
+		{CourseID: course.ID, AccountID: owner.ID, Role: models.EnrollmentRoleInstructor},
+		{CourseID: course.ID, AccountID: ada.ID, Role: models.EnrollmentRoleStudent},
+		{CourseID: course.ID, AccountID: bob.ID, Role: models.EnrollmentRoleStudent},
+	}).Error)
+
+	assignment := testAssignment(t, owner, func(assignment *models.Assignment) { assignment.CourseID = &course.ID })
+	score := 8.0
+	submission := models.Submission{AssignmentID: uint64(assignment.ID), AccountID: ada.ID, SubmissionUrl: "https://example.com/ada.zip", SubmissionRetries: 2, Score: &score}
+	require.NoError(t, db.Create(&submission).Error)
+
+	// Scores of criteria removed from the rubric are left out
+	criteria := []models.RubricCriterion{{AssignmentID: assignment.ID, Name: "Design", Weight: 5}, {AssignmentID: assignment.ID, Name: "Tests", Weight: 5}, {AssignmentID: assignment.ID, Name: "Removed", Weight: 5}}
+	require.NoError(t, db.Create(&criteria).Error)
+	require.NoError(t, db.Delete(&criteria[2]).Error)
+	require.NoError(t, db.Create(&[]models.CriterionScore{
+		{SubmissionID: submission.ID, CriterionID: criteria[1].ID, Points: 3},
+		{SubmissionID: submission.ID, CriterionID: criteria[0].ID, Points: 5},
+		{SubmissionID: submission.ID, CriterionID: criteria[2].ID, Points: 1},
+	}).Error)
+
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/gradebook"
+	w := testRequest(router, http.MethodGet, path, owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Students who haven't submitted are listed as well
+	var entries []models.GradebookEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, ada.ID, entries[0].AccountID)
+	assert.Equal(t, 2, entries[0].Attempts)
+	assert.Equal(t, &score, entries[0].Score)
+	assert.NotEmpty(t, entries[0].LatestSubmission)
+	assert.Equal(t, []models.RubricScore{{Criterion: "Design", Points: 5}, {Criterion: "Tests", Points: 3}}, entries[0].RubricScores)
+	assert.Equal(t, bob.ID, entries[1].AccountID)
+	assert.Equal(t, assignment.ID, entries[1].AssignmentID)
+	assert.Zero(t, entries[1].Attempts)
+	assert.Nil(t, entries[1].Score)
+	assert.Empty(t, entries[1].LatestSubmission)
+	assert.Equal(t, []models.RubricScore{}, entries[1].RubricScores)
+
+	// Assignments without a course list the students who submitted them
+	legacy := testAssignment(t, owner, nil)
+	require.NoError(t, db.Create(&models.Submission{AssignmentID: uint64(legacy.ID), AccountID: bob.ID, SubmissionUrl: "https://example.com/bob.zip", SubmissionRetries: 1}).Error)
+
+	w = testRequest(router, http.MethodGet, "/v1/gradebook", owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	entries = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 3)
+	assert.Equal(t, []uint{assignment.ID, assignment.ID, legacy.ID}, []uint{entries[0].AssignmentID, entries[1].AssignmentID, entries[2].AssignmentID})
+	assert.Equal(t, 1, entries[2].Attempts)
+
+	// Other accounts only see the gradebook of their own assignments
+	w = testRequest(router, http.MethodGet, "/v1/gradebook", ada.Email, nil)
+	assert.Equal(t, "[]", w.Body.String())
+}
+
+func TestGradebookCutShort(t *testing.T) {
+
+	testDatabase(t)
+
+	// The account ID of the row can't be read
+	router := gin.New()
+	router.GET("/gradebook", func(c *gin.Context) {
+		streamGradebook(c, requestDB(c).Raw("SELECT 'first' AS account_id"), "gradebook")
+	})
+	get := func(accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/gradebook", nil)
+		request.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	// The status is already sent, the document can't pass for a complete one
+	w := get(gin.MIMEJSON)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entries []models.GradebookEntry
+	assert.Error(t, json.Unmarshal(w.Body.Bytes(), &entries))
+
+	w = get(mimeCSV)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[1], "error,"), lines[1])
+}
+
+func TestGradebookBatches(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	// Every row of a batch gets the scores of its own submission
+	owner := testAccount(t, "owner@example.com")
+	assignment := testAssignment(t, owner, nil)
+	criterion := models.RubricCriterion{AssignmentID: assignment.ID, Name: "Design", Weight: 10}
+	require.NoError(t, db.Create(&criterion).Error)
+	students := gradebookBatchSize + 2
+	for i := 0; i < students; i++ {
+		student := models.Account{Firstname: "student", LastName: fmt.Sprintf("%04d", i), Email: fmt.Sprintf("student%04d@example.com", i), Password: "-"}
+		require.NoError(t, db.Create(&student).Error)
+		submission := models.Submission{AssignmentID: uint64(assignment.ID), AccountID: student.ID, SubmissionUrl: "https://example.com/lab.zip", SubmissionRetries: 1}
+		require.NoError(t, db.Create(&submission).Error)
+		require.NoError(t, db.Create(&models.CriterionScore{SubmissionID: submission.ID, CriterionID: criterion.ID, Points: float64(i % 10)}).Error)
+	}
+
+	w := testRequest(router, http.MethodGet, "/v1/gradebook", owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []models.GradebookEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, students)
+	for i, entry := range entries {
+		assert.Equal(t, []models.RubricScore{{Criterion: "Design", Points: float64(i % 10)}}, entry.RubricScores, entry.Email)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"app/assignment/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Time a readiness probe gets to answer
+const readinessTimeout = 2 * time.Second
+
+// Free space the disk holding the log file should keep
+const minLogFreeBytes = 100 << 20
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// healthProbe checks one dependency the webapp needs to serve requests
+type healthProbe struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Probes behind /readyz. main adds the notifier once SNS is set up.
+var readinessProbes = []healthProbe{
+	{Name: "database", Check: checkDatabase},
+	{Name: "migrations", Check: checkMigrations},
+	{Name: "disk", Check: checkLogDisk},
+}
+
+// livenessCheck answers as long as the process can serve requests at all.
+// It doesn't look at dependencies, so an outage of the database doesn't get
+// the process restarted.
+func livenessCheck(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	writeHealthReport(c, models.HealthReport{Status: healthOK, Checks: []models.HealthCheck{}})
+}
+
+// readinessCheck returns the handler telling whether the webapp can take
+// traffic, running every probe concurrently. Errors of the probes are only
+// detailed when showErrors is set, as they may describe the infrastructure.
+func readinessCheck(showErrors bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+
+		report := runProbes(c.Request.Context(), readinessProbes)
+		for i, check := range report.Checks {
+			if check.Error != "" {
+				log.Error().Str("check", check.Name).Str("error", check.Error).Msg("Readyz Endpoint:A readiness check failed")
+			}
+			if !showErrors {
+				report.Checks[i].Error = ""
+			}
+		}
+
+		writeHealthReport(c, report)
+	}
+}
+
+// writeHealthReport answers 200 or 503 with an empty body, or with the
+// report as JSON in the detail mode asked for with ?verbose.
+func writeHealthReport(c *gin.Context, report models.HealthReport) {
+	status := http.StatusOK
+	if report.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	if verbose, _ := strconv.ParseBool(c.Query("verbose")); verbose {
+		c.JSON(status, report)
+		return
+	}
+	c.Status(status)
+}
+
+func runProbes(ctx context.Context, probes []healthProbe) models.HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	report := models.HealthReport{Status: healthOK, Checks: make([]models.HealthCheck, len(probes))}
+
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe healthProbe) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := probe.Check(ctx)
+			check := models.HealthCheck{Name: probe.Name, Status: healthOK, Duration: time.Since(start).String()}
+			if err != nil {
+				check.Status = healthUnavailable
+				check.Error = logRedactor.redact(err.Error())
+			}
+			report.Checks[i] = check
+		}(i, probe)
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		if check.Status != healthOK {
+			report.Status = healthUnavailable
+		}
+	}
+	return report
+}
+
+// checkDatabase pings the shared connection pool
+func checkDatabase(ctx context.Context) error {
+	if db == nil {
+		return errors.New("not connected")
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkMigrations verifies that the tables of every model exist
+func checkMigrations(ctx context.Context) error {
+	if db == nil {
+		return errors.New("not connected")
+	}
+
+	migrator := db.WithContext(ctx).Migrator()
+	for _, model := range migratedModels {
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("table of %T is missing", model)
+		}
+	}
+	return nil
+}
+
+// checkLogDisk verifies that the log file can keep growing
+func checkLogDisk(ctx context.Context) error {
+	free, err := freeDiskBytes(filepath.Dir(logFilePath))
+	if err != nil {
+		return err
+	}
+	if free < minLogFreeBytes {
+		return fmt.Errorf("only %d MiB left for %s", free>>20, logFilePath)
+	}
+	return nil
+}
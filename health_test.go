@@ -0,0 +1,75 @@
+package main
+
+import (
+	"app/assignment/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadinessCheck(t *testing.T) {
+
+	probes := readinessProbes
+	defer func() { readinessProbes = probes }()
+
+	readinessProbes = []healthProbe{
+		{Name: "database", Check: func(ctx context.Context) error { return nil }},
+		{Name: "notifier", Check: func(ctx context.Context) error { return nil }},
+	}
+
+	router := gin.New()
+	router.GET("/livez", livenessCheck)
+	router.GET("/readyz", readinessCheck(false))
+	router.GET("/admin/readyz", readinessCheck(true))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// Plain probes only answer with the status
+	w := get("/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = get("/readyz?verbose=true")
+	var report models.HealthReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, healthOK, report.Status)
+	assert.Len(t, report.Checks, 2)
+
+	// A failing or hanging dependency makes the webapp unready, not dead
+	readinessProbes = append(readinessProbes, healthProbe{Name: "disk", Check: func(ctx context.Context) error {
+		return errors.New("only 12 MiB left for app.log")
+	}}, healthProbe{Name: "migrations", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	start := time.Now()
+	w = get("/readyz?verbose=1")
+	assert.Less(t, time.Since(start), readinessTimeout+time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	report = models.HealthReport{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, healthUnavailable, report.Status)
+	assert.Equal(t, models.HealthCheck{Name: "disk", Status: healthUnavailable, Duration: report.Checks[2].Duration}, report.Checks[2])
+	assert.Equal(t, healthUnavailable, report.Checks[3].Status)
+
+	// Errors are only detailed for operators
+	w = get("/admin/readyz?verbose=true")
+	report = models.HealthReport{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "only 12 MiB left for app.log", report.Checks[2].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks[3].Error)
+
+	assert.Equal(t, http.StatusOK, get("/livez").Code)
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// Header row of the CSV assignment export. The rubric column holds the
+// criteria as a JSON array.
+var assignmentCSVHeader = []string{
+	"name", "points", "noofattempts", "deadline",
+	"late_policy", "grace_period_minutes", "late_until", "late_penalty_per_day",
+	"publish_at", "course_id", "team_mode", "max_team_size", "rubric",
+}
+
+func exportAssignments(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("exportassignments_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("ExportAssignments Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("ExportAssignments Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	format := c.NegotiateFormat(gin.MIMEJSON, mimeCSV)
+	if format == "" {
+		err := errors.New("UNSUPPORTED FORMAT")
+		requestLogger(c).Error().Err(err).Msg("ExportAssignments Endpoint:The requested format is not supported")
+		abortWithProblem(c, http.StatusNotAcceptable, "UNSUPPORTED_FORMAT", "Assignments are exported as application/json or text/csv")
+		return
+	}
+
+	// Only the assignments owned by the account are exported
+	var assignments []models.Assignment
+	if err := withRubric(requestDB(c)).Where("account_id = ?", userID).Order("id").Find(&assignments).Error; err != nil {
+		err := errors.New("ASSIGNMENT RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("ExportAssignments Endpoint:Unable to retrieve assignments from database")
+		abortWithProblem(c, http.StatusInternalServerError, "ASSIGNMENT_RETRIEVAL_ERROR", "Unable to retrieve assignments from database")
+		return
+	}
+
+	// Assignments are exported as the input that recreates them, so an
+	// export can be imported as is into another environment
+	inputs := []models.AssignmentInput{}
+	for _, assignment := range assignments {
+		inputs = append(inputs, assignmentInputFromAssignment(assignment))
+	}
+
+	requestLogger(c).Info().Int("assignments", len(inputs)).Msg("ExportAssignments Endpoint:Successfully exported the assignments")
+
+	if format == gin.MIMEJSON {
+		c.Header("Content-Disposition", `attachment; filename="assignments.json"`)
+		c.JSON(http.StatusOK, inputs)
+		return
+	}
+
+	c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="assignments.csv"`)
+	c.Status(http.StatusOK)
+	csvWriter := csv.NewWriter(c.Writer)
+	csvWriter.Write(assignmentCSVHeader)
+	for _, input := range inputs {
+		csvWriter.Write(assignmentCSVRecord(input))
+	}
+	csvWriter.Flush()
+}
+
+// importAssignments creates the assignments of a JSON or CSV document. Every
+// row is validated first and the assignments are only created when all of
+// them are valid. With dry_run=true nothing is created and the validation
+// report is returned.
+func importAssignments(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("importassignments_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("ImportAssignments Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("ImportAssignments Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		err := errors.New("INVALID QUERY PARAMETER")
+		requestLogger(c).Error().Err(err).Msg("ImportAssignments Endpoint:The dry_run parameter is invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_QUERY_PARAMETER", "dry_run should be true or false")
+		return
+	}
+
+	var inputs []*models.AssignmentInput
+	importResponse := models.AssignmentImportResponse{DryRun: dryRun, Errors: []string{}, Assignments: assignmentResponses(c, nil)}
+	switch c.ContentType() {
+	case gin.MIMEJSON:
+		inputs, importResponse.Errors, err = readAssignmentJSON(c.Request.Body)
+		if err != nil {
+			err := errors.New("INCORRECT REQUEST BODY")
+			requestLogger(c).Error().Err(err).Msg("ImportAssignments Endpoint:The request body is incorrect")
+			abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The JSON document should be an array of assignments")
+			return
+		}
+	case mimeCSV:
+		inputs, importResponse.Errors, err = readAssignmentCSV(c.Request.Body)
+		if err != nil {
+			requestLogger(c).Error().Err(err).Msg("ImportAssignments Endpoint:The CSV document is incorrect")
+			abortWithProblem(c, http.StatusBadRequest, "INVALID_CSV", err.Error())
+			return
+		}
+	default:
+		err := errors.New("UNSUPPORTED FORMAT")
+		requestLogger(c).Error().Err(err).Msg("ImportAssignments Endpoint:The content type is not supported")
+		abortWithProblem(c, http.StatusUnsupportedMediaType, "UNSUPPORTED_FORMAT", "Assignments are imported from application/json or text/csv")
+		return
+	}
+
+	// Rows that couldn't be read are already reported, validate the others
+	// with the same rules as a single assignment
+	newAssignments := []models.Assignment{}
+	for i, input := range inputs {
+		if input == nil {
+			continue
+		}
+		if err := validateAssignmentInput(input); err != nil {
+			importResponse.Errors = append(importResponse.Errors, fmt.Sprintf("row %d: %s", i+1, describeInvalidInput(err)))
+			continue
+		}
+		courseID, err := assignmentCourse(requestDB(c), input.CourseID, userID)
+		if errors.Is(err, errCourseRequired) {
+			importResponse.Errors = append(importResponse.Errors, fmt.Sprintf("row %d: course_id is required", i+1))
+			continue
+		}
+		if err != nil {
+			importResponse.Errors = append(importResponse.Errors, fmt.Sprintf("row %d: you are not an instructor of course %d", i+1, input.CourseID))
+			continue
+		}
+		newAssignments = append(newAssignments, newAssignmentFromInput(*input, userID, courseID))
+	}
+	importResponse.Valid = len(newAssignments)
+
+	if dryRun {
+		requestLogger(c).Info().Int("valid", importResponse.Valid).Int("errors", len(importResponse.Errors)).Msg("ImportAssignments Endpoint:Validated the assignments")
+		c.JSON(http.StatusOK, importResponse)
+		return
+	}
+
+	if len(importResponse.Errors) > 0 || len(newAssignments) == 0 {
+		err := errors.New("INVALID ASSIGNMENTS")
+		requestLogger(c).Error().Err(err).Int("errors", len(importResponse.Errors)).Msg("ImportAssignments Endpoint:Nothing was imported")
+		abortWithError(c, &problemError{Status: http.StatusBadRequest, Code: "INVALID_ASSIGNMENTS", Detail: "Nothing was imported, fix the invalid assignments first", Errors: importResponse.Errors})
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		for i := range newAssignments {
+			if err := tx.Create(&newAssignments[i]).Error; err != nil {
+				return err
+			}
+			if err := recordRevision(tx, userID, revisionCreate, newAssignments[i]); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, userID, "assignment.import", "assignment", newAssignments[i].ID, gin.H{"row": i + 1}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		err := errors.New("ASSIGNMENT CREATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("ImportAssignments Endpoint:An error occured while creating the assignments")
+		abortWithProblem(c, http.StatusInternalServerError, "ASSIGNMENT_CREATION_ERROR", "An error occured while creating the assignments")
+		return
+	}
+
+	importResponse.Assignments = assignmentResponses(c, newAssignments)
+
+	requestLogger(c).Info().Int("assignments", len(newAssignments)).Msg("ImportAssignments Endpoint:Successfully imported the assignments")
+
+	c.JSON(http.StatusCreated, importResponse)
+}
+
+// assignmentCSVRecord flattens an assignment input into a CSV record matching assignmentCSVHeader
+func assignmentCSVRecord(input models.AssignmentInput) []string {
+	rubric, _ := json.Marshal(input.Rubric)
+
+	courseID := ""
+	if input.CourseID != 0 {
+		courseID = strconv.FormatUint(uint64(input.CourseID), 10)
+	}
+
+	return []string{
+		input.Name,
+		strconv.Itoa(input.Points),
+		strconv.Itoa(input.NoOfAttempts),
+		input.Deadline,
+		input.LatePolicy,
+		strconv.Itoa(input.GracePeriodMinutes),
+		input.LateUntil,
+		strconv.FormatFloat(input.LatePenaltyPerDay, 'f', -1, 64),
+		input.PublishAt,
+		courseID,
+		input.TeamMode,
+		strconv.Itoa(input.MaxTeamSize),
+		string(rubric),
+	}
+}
+
+// readAssignmentJSON reads the assignments of a JSON array. Each row is
+// decoded like a single assignment by the binding layer, rejecting unknown
+// fields. Rows that can't be read are reported in the returned errors and
+// left nil in the returned inputs, so row numbers stay aligned.
+func readAssignmentJSON(body io.Reader) ([]*models.AssignmentInput, []string, error) {
+	inputs := []*models.AssignmentInput{}
+	rowErrors := []string{}
+
+	var rows []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&rows); err != nil {
+		return inputs, rowErrors, err
+	}
+
+	for i, row := range rows {
+		if string(row) == "null" {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: assignment is empty", i+1))
+			inputs = append(inputs, nil)
+			continue
+		}
+
+		var input models.AssignmentInput
+		decoder := json.NewDecoder(bytes.NewReader(row))
+		if binding.EnableDecoderUseNumber {
+			decoder.UseNumber()
+		}
+		if binding.EnableDecoderDisallowUnknownFields {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&input); err != nil {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: %s", i+1, describeInvalidInput(err)))
+			inputs = append(inputs, nil)
+			continue
+		}
+		inputs = append(inputs, &input)
+	}
+
+	return inputs, rowErrors, nil
+}
+
+// readAssignmentCSV reads the assignments of a CSV document. Columns are
+// matched by the names of the header line. Rows that can't be read are
+// reported in the returned errors and left nil in the returned inputs, so
+// row numbers stay aligned.
+func readAssignmentCSV(body io.Reader) ([]*models.AssignmentInput, []string, error) {
+	inputs := []*models.AssignmentInput{}
+	rowErrors := []string{}
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return inputs, rowErrors, errors.New("The CSV document needs a header line")
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, required := range []string{"name", "points", "noofattempts", "deadline"} {
+		if _, ok := columns[required]; !ok {
+			return inputs, rowErrors, fmt.Errorf("The CSV document needs a %s column", required)
+		}
+	}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var input models.AssignmentInput
+		if err == nil {
+			input, err = assignmentInputFromCSV(record, columns)
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: %v", row, err))
+			inputs = append(inputs, nil)
+			continue
+		}
+		inputs = append(inputs, &input)
+	}
+
+	return inputs, rowErrors, nil
+}
+
+func assignmentInputFromCSV(record []string, columns map[string]int) (models.AssignmentInput, error) {
+	var input models.AssignmentInput
+
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	number := func(name string) (int, error) {
+		if field(name) == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(field(name))
+		if err != nil {
+			return 0, fmt.Errorf("%s should be a whole number", name)
+		}
+		return n, nil
+	}
+
+	var err error
+	input.Name = field("name")
+	input.Deadline = field("deadline")
+	input.LatePolicy = field("late_policy")
+	input.LateUntil = field("late_until")
+	input.PublishAt = field("publish_at")
+	input.TeamMode = field("team_mode")
+	if input.Points, err = number("points"); err != nil {
+		return input, err
+	}
+	if input.NoOfAttempts, err = number("noofattempts"); err != nil {
+		return input, err
+	}
+	if input.GracePeriodMinutes, err = number("grace_period_minutes"); err != nil {
+		return input, err
+	}
+	if input.MaxTeamSize, err = number("max_team_size"); err != nil {
+		return input, err
+	}
+	courseID, err := number("course_id")
+	if err != nil || courseID < 0 {
+		return input, errors.New("course_id should be a course ID")
+	}
+	input.CourseID = uint(courseID)
+	if penalty := field("late_penalty_per_day"); penalty != "" {
+		if input.LatePenaltyPerDay, err = strconv.ParseFloat(penalty, 64); err != nil {
+			return input, errors.New("late_penalty_per_day should be a number")
+		}
+	}
+	if rubric := field("rubric"); rubric != "" {
+		if err := json.Unmarshal([]byte(rubric), &input.Rubric); err != nil {
+			return input, errors.New("rubric should be a JSON array of criteria")
+		}
+	}
+
+	return input, nil
+}
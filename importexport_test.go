@@ -0,0 +1,121 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAssignmentCSV(t *testing.T) {
+
+	exported := models.AssignmentInput{
+		Name:         "Lab 1",
+		Points:       10,
+		NoOfAttempts: 2,
+		Deadline:     "2024-01-10T23:59:00.000Z",
+		LatePolicy:   models.LatePolicyHardCutoff,
+		Rubric:       []models.RubricCriterionInput{{Name: "Design", Weight: 10}},
+	}
+
+	// An exported row reads back as the same assignment
+	document := strings.Join(assignmentCSVHeader, ",") + "\n" +
+		strings.Join(quoteCSV(assignmentCSVRecord(exported)), ",") + "\n" +
+		"Lab 2,ten,1,2024-01-10T23:59:00.000Z,,,,,,,,,\n"
+	inputs, rowErrors, err := readAssignmentCSV(strings.NewReader(document))
+	assert.NoError(t, err)
+	assert.Len(t, inputs, 2)
+	assert.Equal(t, exported, *inputs[0])
+
+	// Rows that can't be read are reported and kept as nil to keep row numbers
+	assert.Nil(t, inputs[1])
+	assert.Equal(t, []string{"row 2: points should be a whole number"}, rowErrors)
+
+	// Required columns have to be present
+	_, _, err = readAssignmentCSV(strings.NewReader("name,points,deadline\n"))
+	assert.Error(t, err)
+}
+
+func TestReadAssignmentJSON(t *testing.T) {
+
+	document := `[
+		{"name": "Lab 1", "points": 10, "noofattempts": 2, "deadline": "2024-01-10T23:59:00.000Z"},
+		{"name": "Lab 2", "points": 10, "noofattempts": 2, "deadlin": "2024-01-10T23:59:00.000Z"},
+		{"name": "Lab 3", "points": "ten"},
+		null
+	]`
+	inputs, rowErrors, err := readAssignmentJSON(strings.NewReader(document))
+	assert.NoError(t, err)
+	require.Len(t, inputs, 4)
+	assert.Equal(t, "Lab 1", inputs[0].Name)
+
+	// Misspelled fields are reported like in a single assignment
+	assert.Nil(t, inputs[1])
+	assert.Nil(t, inputs[2])
+	assert.Nil(t, inputs[3])
+	assert.Equal(t, []string{
+		"row 2: deadlin is not a known field",
+		"row 3: points should be a whole number",
+		"row 4: assignment is empty",
+	}, rowErrors)
+
+	_, _, err = readAssignmentJSON(strings.NewReader(`{"name": "Lab 1"}`))
+	assert.Error(t, err)
+}
+
+func quoteCSV(record []string) []string {
+	quoted := []string{}
+	for _, field := range record {
+		quoted = append(quoted, `"`+strings.ReplaceAll(field, `"`, `""`)+`"`)
+	}
+	return quoted
+}
+
+func TestImportPastDeadline(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	course := models.Course{Name: "Cloud Computing", Code: "CSYE6225", AccountID: owner.ID}
+	require.NoError(t, db.Create(&course).Error)
+	require.NoError(t, db.Create(&models.Enrollment{CourseID: course.ID, AccountID: owner.ID, Role: models.EnrollmentRoleInstructor}).Error)
+	input := models.AssignmentInput{Name: "Lab 1", Points: 10, NoOfAttempts: 3, Deadline: "2020-01-10T23:59:00.000Z", CourseID: course.ID}
+
+	// New assignments can't be due already
+	w := testRequest(router, http.MethodPost, "/v1/assignments", owner.Email, input)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "should be in the future")
+
+	// but assignments of past terms can be imported back, the assignments
+	// being listed in the shape of the API version
+	w = testRequest(router, http.MethodPost, "/v2/assignments/import?dry_run=true", owner.Email, []models.AssignmentInput{input})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"dry_run": true, "valid": 1, "errors": [], "assignments": []}`, w.Body.String())
+	w = testRequest(router, http.MethodPost, "/v2/assignments/import", owner.Email, []models.AssignmentInput{input})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"created_at"`)
+
+	input.Name = "Lab 1, again"
+	w = testRequest(router, http.MethodPost, "/v1/assignments/import", owner.Email, []models.AssignmentInput{input})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var imported struct {
+		Assignments []models.AssignmentResponse `json:"assignments"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imported))
+	require.Len(t, imported.Assignments, 1)
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(imported.Assignments[0].ID), 10)
+
+	// and edited as long as the deadline is kept
+	input.Name = "Lab 1, 2020"
+	w = testRequest(router, http.MethodPut, path, owner.Email, input)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	input.Deadline = "2020-01-11T23:59:00.000Z"
+	w = testRequest(router, http.MethodPut, path, owner.Email, input)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"app/assignment/models"
+	"errors"
+	"math"
+	"time"
+)
+
+var errDeadlineParse = errors.New("DEADLINE PARSE ERROR")
+var errDeadlinePassed = errors.New("DEADLINE PASSED")
+
+// validateLatePolicy checks the late policy settings of an assignment input
+// and fills in the default policy when none is given.
+func validateLatePolicy(input *models.AssignmentInput) error {
+	if input.LatePolicy == "" {
+		input.LatePolicy = models.LatePolicyHardCutoff
+	}
+
+	switch input.LatePolicy {
+	case models.LatePolicyHardCutoff:
+	case models.LatePolicyGracePeriod:
+		if input.GracePeriodMinutes <= 0 {
+			return errors.New("grace_period_minutes should be greater than 0 for a grace period policy")
+		}
+	case models.LatePolicyLateUntil:
+		deadline, err := time.Parse(deadlineLayout, input.Deadline)
+		if err != nil {
+			return errors.New("deadline should be in the format " + deadlineLayout)
+		}
+		lateUntil, err := time.Parse(deadlineLayout, input.LateUntil)
+		if err != nil {
+			return errors.New("late_until should be in the format " + deadlineLayout)
+		}
+		if !lateUntil.After(deadline) {
+			return errors.New("late_until should be after the deadline")
+		}
+		if input.LatePenaltyPerDay < 0 || input.LatePenaltyPerDay > 100 {
+			return errors.New("late_penalty_per_day should be between 0 and 100")
+		}
+	default:
+		return errors.New("late_policy should be one of hard_cutoff, grace_period or late_until")
+	}
+
+	return nil
+}
+
+// evaluateLatePolicy decides whether a submission made at the given time
+// against the given deadline is late, and the percentage penalty it carries.
+// errDeadlinePassed is returned when the policy no longer accepts submissions.
+func evaluateLatePolicy(assignment models.Assignment, deadline string, at time.Time) (bool, float64, error) {
+	deadlineTime, err := time.Parse(deadlineLayout, deadline)
+	if err != nil {
+		return false, 0, errDeadlineParse
+	}
+
+	if !at.After(deadlineTime) {
+		return false, 0, nil
+	}
+
+	switch assignment.LatePolicy {
+	case models.LatePolicyGracePeriod:
+		graceEnd := deadlineTime.Add(time.Duration(assignment.GracePeriodMinutes) * time.Minute)
+		if at.After(graceEnd) {
+			return true, 0, errDeadlinePassed
+		}
+		return true, 0, nil
+
+	case models.LatePolicyLateUntil:
+		lateUntil, err := time.Parse(deadlineLayout, assignment.LateUntil)
+		if err != nil {
+			return true, 0, errDeadlineParse
+		}
+		if at.After(lateUntil) {
+			return true, 0, errDeadlinePassed
+		}
+
+		// Every started day after the deadline counts as a full day
+		daysLate := math.Ceil(at.Sub(deadlineTime).Hours() / 24)
+		return true, math.Min(100, daysLate*assignment.LatePenaltyPerDay), nil
+
+	default:
+		return true, 0, errDeadlinePassed
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"app/assignment/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateLatePolicy(t *testing.T) {
+
+	deadline := "2023-11-01T12:00:00.000Z"
+	deadlineTime, _ := time.Parse(deadlineLayout, deadline)
+
+	hardCutoff := models.Assignment{LatePolicy: models.LatePolicyHardCutoff}
+	gracePeriod := models.Assignment{LatePolicy: models.LatePolicyGracePeriod, GracePeriodMinutes: 30}
+	lateUntil := models.Assignment{LatePolicy: models.LatePolicyLateUntil, LateUntil: "2023-11-05T12:00:00.000Z", LatePenaltyPerDay: 10}
+
+	// On time submissions are never late
+	late, penalty, err := evaluateLatePolicy(hardCutoff, deadline, deadlineTime.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, late)
+	assert.Equal(t, 0.0, penalty)
+
+	// Hard cutoff rejects anything after the deadline
+	_, _, err = evaluateLatePolicy(hardCutoff, deadline, deadlineTime.Add(time.Second))
+	assert.Equal(t, errDeadlinePassed, err)
+
+	// Grace period accepts late submissions without penalty until it expires
+	late, penalty, err = evaluateLatePolicy(gracePeriod, deadline, deadlineTime.Add(20*time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, late)
+	assert.Equal(t, 0.0, penalty)
+
+	_, _, err = evaluateLatePolicy(gracePeriod, deadline, deadlineTime.Add(31*time.Minute))
+	assert.Equal(t, errDeadlinePassed, err)
+
+	// Late until charges every started day after the deadline
+	late, penalty, err = evaluateLatePolicy(lateUntil, deadline, deadlineTime.Add(25*time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, late)
+	assert.Equal(t, 20.0, penalty)
+
+	_, _, err = evaluateLatePolicy(lateUntil, deadline, deadlineTime.Add(5*24*time.Hour))
+	assert.Equal(t, errDeadlinePassed, err)
+
+	// Unparseable deadlines are reported
+	_, _, err = evaluateLatePolicy(hardCutoff, "tomorrow", deadlineTime)
+	assert.Equal(t, errDeadlineParse, err)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Statuses an assignment can move to from each status
+var assignmentTransitions = map[string]string{
+	models.AssignmentStatusDraft:     models.AssignmentStatusPublished,
+	models.AssignmentStatusPublished: models.AssignmentStatusClosed,
+	models.AssignmentStatusClosed:    models.AssignmentStatusArchived,
+}
+
+// Returned when the status of an assignment changed after it was checked
+var errStatusChanged = errors.New("STATUS CHANGED")
+
+// transitionAssignment returns the handler moving an assignment to the given status
+func transitionAssignment(status string) gin.HandlerFunc {
+	endpoint := strings.ToUpper(status[:1]) + status[1:] + "Assignment"
+
+	return func(c *gin.Context) {
+
+		// Increment the counter metric every time the API is hit
+		appMetrics.Count(strings.ToLower(endpoint) + "_counter")
+
+		c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+		c.Header("Pragma", "no-cache")
+		c.Header("X-Content-Type-Options", "nosniff")
+
+		requestLogger(c).Info().Msg(endpoint + " Endpoint")
+
+		// Authenticate the user and obtain their user ID
+		userID, err := controllers.AuthenticateUser(c, db)
+		if err != nil {
+			err := errors.New("AUTHENTICATION ERROR")
+			requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:Unable to authenticate the request")
+			abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+			return
+		}
+
+		assignment, ok := findOwnedAssignment(c, endpoint, userID)
+		if !ok {
+			return
+		}
+
+		if assignmentTransitions[assignment.Status] != status {
+			err := errors.New("INVALID STATUS TRANSITION")
+			requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment can't move to the requested status")
+			abortWithProblem(c, http.StatusConflict, "INVALID_STATUS_TRANSITION", "Assignment in status "+assignment.Status+" can't be moved to "+status)
+			return
+		}
+
+		// The status may have changed since it was read, by another request
+		// or the publish scheduler
+		previous := assignment.Status
+		err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&assignment).Where("status = ?", previous).Update("status", status)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errStatusChanged
+			}
+			assignment.Status = status
+			if err := recordRevision(tx, userID, status, assignment); err != nil {
+				return err
+			}
+
+			return recordAudit(tx, userID, "assignment."+status, "assignment", assignment.ID, gin.H{"from": previous, "to": status})
+		})
+		if err == errStatusChanged {
+			requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The status of the assignment changed in the meantime")
+			abortWithProblem(c, http.StatusConflict, "INVALID_STATUS_TRANSITION", "Assignment is no longer in status "+previous)
+			return
+		}
+		if err != nil {
+			err := errors.New("UPDATE ERROR")
+			requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:Failed to update the assignment status")
+			abortWithProblem(c, http.StatusInternalServerError, "UPDATE_ERROR", "Failed to update the assignment status")
+			return
+		}
+
+		requestLogger(c).Info().Msg(endpoint + " Endpoint:Successfully updated the assignment status")
+
+		renderAssignment(c, http.StatusOK, assignment)
+	}
+}
+
+// parsePublishAt parses the optional publish date of an assignment input
+func parsePublishAt(publishAt string) (*time.Time, error) {
+	if publishAt == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(deadlineLayout, publishAt)
+	if err != nil {
+		return nil, errors.New("publish_at should be in the format " + deadlineLayout)
+	}
+
+	return &t, nil
+}
+
+func formatPublishAt(publishAt *time.Time) string {
+	if publishAt == nil {
+		return ""
+	}
+
+	return publishAt.UTC().Format(deadlineLayout)
+}
+
+// publishScheduledAssignments publishes the drafts whose publish date has come
+// by the given time. Its queries stop when the context of tx is done.
+func publishScheduledAssignments(tx *gorm.DB, now time.Time) {
+	var assignments []models.Assignment
+	err := withRubric(tx).
+		Where("status = ? AND publish_at IS NOT NULL AND publish_at <= ?", models.AssignmentStatusDraft, now.UTC()).
+		Find(&assignments).Error
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to find the scheduled assignments")
+		return
+	}
+
+	published := 0
+	for _, assignment := range assignments {
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&assignment).Where("status = ?", models.AssignmentStatusDraft).Update("status", models.AssignmentStatusPublished)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error // published in the meantime
+			}
+			assignment.Status = models.AssignmentStatusPublished
+			return recordRevision(tx, 0, models.AssignmentStatusPublished, assignment)
+		})
+		if err != nil {
+			log.Error().Err(err).Uint("assignment_id", assignment.ID).Msg("Unable to publish a scheduled assignment")
+			continue
+		}
+		if assignment.Status == models.AssignmentStatusPublished {
+			published++
+		}
+	}
+
+	if published > 0 {
+		log.Info().Int("assignments", published).Msg("Published the scheduled assignments")
+	}
+}
+
+func runPublishScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		publishScheduledAssignments(db.WithContext(ctx), time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionAssignment(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	other := testAccount(t, "other@example.com")
+
+	tests := []struct {
+		name   string
+		from   string
+		action string
+		email  string
+		status int
+	}{
+		{"publish a draft", models.AssignmentStatusDraft, "publish", owner.Email, http.StatusOK},
+		{"close a published assignment", models.AssignmentStatusPublished, "close", owner.Email, http.StatusOK},
+		{"archive a closed assignment", models.AssignmentStatusClosed, "archive", owner.Email, http.StatusOK},
+		{"close a draft", models.AssignmentStatusDraft, "close", owner.Email, http.StatusConflict},
+		{"archive a published assignment", models.AssignmentStatusPublished, "archive", owner.Email, http.StatusConflict},
+		{"publish a published assignment", models.AssignmentStatusPublished, "publish", owner.Email, http.StatusConflict},
+		{"publish a closed assignment", models.AssignmentStatusClosed, "publish", owner.Email, http.StatusConflict},
+		{"publish an archived assignment", models.AssignmentStatusArchived, "publish", owner.Email, http.StatusConflict},
+		{"close an archived assignment", models.AssignmentStatusArchived, "close", owner.Email, http.StatusConflict},
+		{"publish the draft of another account", models.AssignmentStatusDraft, "publish", other.Email, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assignment := testAssignment(t, owner, func(assignment *models.Assignment) { assignment.Status = test.from })
+
+			path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/" + test.action
+			w := testRequest(router, http.MethodPost, path, test.email, nil)
+			require.Equal(t, test.status, w.Code, w.Body.String())
+
+			var stored models.Assignment
+			require.NoError(t, db.First(&stored, assignment.ID).Error)
+			var revisions int64
+			require.NoError(t, db.Model(&models.AssignmentRevision{}).Where("assignment_id = ?", assignment.ID).Count(&revisions).Error)
+			if test.status != http.StatusOK {
+				assert.Equal(t, test.from, stored.Status)
+				assert.Zero(t, revisions)
+				return
+			}
+
+			var response models.AssignmentResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, assignmentTransitions[test.from], response.Status)
+			assert.Equal(t, assignmentTransitions[test.from], stored.Status)
+			assert.Equal(t, int64(1), revisions)
+		})
+	}
+}
+
+func TestPublishScheduledAssignments(t *testing.T) {
+
+	testDatabase(t)
+
+	owner := testAccount(t, "owner@example.com")
+	now := time.Date(2099, 1, 1, 12, 0, 0, 0, time.UTC)
+	schedule := func(status string, publishAt *time.Time) models.Assignment {
+		return testAssignment(t, owner, func(assignment *models.Assignment) {
+			assignment.Status = status
+			assignment.PublishAt = publishAt
+		})
+	}
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	due := schedule(models.AssignmentStatusDraft, &past)
+	onTime := schedule(models.AssignmentStatusDraft, &now)
+	later := schedule(models.AssignmentStatusDraft, &future)
+	unscheduled := schedule(models.AssignmentStatusDraft, nil)
+	closed := schedule(models.AssignmentStatusClosed, &past)
+
+	publishScheduledAssignments(db, now)
+
+	for assignment, status := range map[uint]string{
+		due.ID:         models.AssignmentStatusPublished,
+		onTime.ID:      models.AssignmentStatusPublished,
+		later.ID:       models.AssignmentStatusDraft,
+		unscheduled.ID: models.AssignmentStatusDraft,
+		closed.ID:      models.AssignmentStatusClosed,
+	} {
+		var stored models.Assignment
+		require.NoError(t, db.First(&stored, assignment).Error)
+		assert.Equal(t, status, stored.Status, "assignment %d", assignment)
+	}
+
+	// The scheduler records who published as account 0
+	var revisions []models.AssignmentRevision
+	require.NoError(t, db.Order("assignment_id").Find(&revisions).Error)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, []uint{due.ID, onTime.ID}, []uint{revisions[0].AssignmentID, revisions[1].AssignmentID})
+	assert.Zero(t, revisions[0].AccountID)
+	assert.Equal(t, models.AssignmentStatusPublished, revisions[0].Action)
+
+	// Published drafts aren't published again
+	publishScheduledAssignments(db, now.Add(time.Hour))
+	require.NoError(t, db.Model(&models.AssignmentRevision{}).Where("assignment_id IN ?", []uint{due.ID, onTime.ID}).Find(&revisions).Error)
+	assert.Len(t, revisions, 2)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"gorm.io/gorm/logger"
+)
+
+// Permissions of the log file, readable by the group of the webapp for the
+// CloudWatch agent but by no one else
+const logFileMode = 0640
+
+// Path of the log file of the webapp, set up by main from log.file
+var logFilePath = "app.log"
+
+// logConfig holds the settings of the logs
+type logConfig struct {
+	Level   zerolog.Level `yaml:"level"`   // debug, info, warn or error
+	Format  string        `yaml:"format"`  // json or console
+	Outputs []string      `yaml:"outputs"` // file and stdout
+
+	// Secrets are always redacted, these fields of personal data too
+	RedactFields []string `yaml:"redact_fields"`
+
+	// The log file is rotated once it reaches MaxSizeMB, or every
+	// RotateInterval when set. Rotated files are compressed and removed
+	// after MaxAgeDays or beyond MaxBackups, when those are set.
+	File           string        `yaml:"file"`
+	MaxSizeMB      int           `yaml:"max_size_mb"`
+	RotateInterval time.Duration `yaml:"rotate_interval"`
+	MaxAgeDays     int           `yaml:"max_age_days"`
+	MaxBackups     int           `yaml:"max_backups"`
+	Compress       bool          `yaml:"compress"`
+}
+
+func (c logConfig) validate() error {
+	var errs []error
+
+	if c.Level < zerolog.DebugLevel || c.Level > zerolog.ErrorLevel {
+		errs = append(errs, fmt.Errorf("log.level should be debug, info, warn or error, got %q", c.Level))
+	}
+	if c.Format != "json" && c.Format != "console" {
+		errs = append(errs, fmt.Errorf("log.format should be json or console, got %q", c.Format))
+	}
+	for _, output := range c.Outputs {
+		if output != "file" && output != "stdout" {
+			errs = append(errs, fmt.Errorf("log.outputs should list file or stdout, got %q", output))
+		}
+	}
+
+	if c.MaxSizeMB < 1 {
+		errs = append(errs, fmt.Errorf("log.max_size_mb should be at least 1, got %d", c.MaxSizeMB))
+	}
+	if c.RotateInterval < 0 {
+		errs = append(errs, fmt.Errorf("log.rotate_interval should be a duration such as 24h, 0 for never, got %s", c.RotateInterval))
+	}
+	counts := []struct {
+		key   string
+		value int
+	}{
+		{"log.max_age_days", c.MaxAgeDays},
+		{"log.max_backups", c.MaxBackups},
+	}
+	for _, count := range counts {
+		if count.value < 0 {
+			errs = append(errs, fmt.Errorf("%s should be a number, 0 for no limit, got %d", count.key, count.value))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setupLogging points the global logger to the outputs of the config,
+// through the redactor, and returns the log file to reopen and close, nil
+// when logs don't go to one.
+func setupLogging(config logConfig) (*lumberjack.Logger, error) {
+	zerolog.SetGlobalLevel(config.Level)
+	piiFields := []string{}
+	for _, field := range config.RedactFields {
+		if field != "none" {
+			piiFields = append(piiFields, field)
+		}
+	}
+	logRedactor = newRedactor(piiFields)
+
+	var file *lumberjack.Logger
+	writers := []io.Writer{}
+	for _, output := range config.Outputs {
+		switch output {
+		case "file":
+			if err := createLogFile(config.File); err != nil {
+				return nil, err
+			}
+			file = &lumberjack.Logger{
+				Filename:   config.File,
+				MaxSize:    config.MaxSizeMB,
+				MaxAge:     config.MaxAgeDays,
+				MaxBackups: config.MaxBackups,
+				Compress:   config.Compress,
+			}
+			writers = append(writers, formatLogs(file, config.Format, true))
+			logFilePath = config.File
+		case "stdout":
+			// journald collects stdout when running under systemd
+			writers = append(writers, formatLogs(os.Stdout, config.Format, false))
+		}
+	}
+
+	out := redactingWriter{out: zerolog.MultiLevelWriter(writers...), redactor: logRedactor}
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+	return file, nil
+}
+
+func formatLogs(out io.Writer, format string, noColor bool) io.Writer {
+	if format == "console" {
+		return zerolog.ConsoleWriter{Out: out, NoColor: noColor, TimeFormat: time.RFC3339}
+	}
+	return out
+}
+
+// createLogFile creates the log file with logFileMode, and takes away the
+// permissions beyond it from a file created by an earlier version, so the
+// rotated files, which keep the mode of the file, get them too.
+func createLogFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFileMode)
+	if err != nil {
+		return fmt.Errorf("unable to open the log file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&^logFileMode != 0 {
+		return file.Chmod(info.Mode().Perm() & logFileMode)
+	}
+	return nil
+}
+
+// maintainLogFile reopens the log file on SIGHUP, once logrotate has moved
+// it away, and rotates it every interval when one is set, until the context
+// is cancelled.
+func maintainLogFile(ctx context.Context, file *lumberjack.Logger, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var rotate <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		rotate = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := reopenLogFile(file); err != nil {
+				log.Error().Err(err).Str("file", file.Filename).Msg("Unable to reopen the log file")
+				continue
+			}
+			log.Info().Str("file", file.Filename).Msg("Reopened the log file")
+		case <-rotate:
+			if err := file.Rotate(); err != nil {
+				log.Error().Err(err).Str("file", file.Filename).Msg("Unable to rotate the log file")
+			}
+		}
+	}
+}
+
+// reopenLogFile moves the writes to a new file under the name of the log
+// file. The file is created with logFileMode before the current one is
+// closed, as a write in between would have lumberjack create it with 0600.
+func reopenLogFile(file *lumberjack.Logger) error {
+	if err := createLogFile(file.Filename); err != nil {
+		return err
+	}
+
+	// The next write opens the file again under its name
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("unable to close the log file: %w", err)
+	}
+	return nil
+}
+
+// gormLogWriter passes the slow statements and errors gorm reports to the
+// logger of the webapp instead of stdout.
+type gormLogWriter struct{}
+
+func (gormLogWriter) Printf(format string, args ...interface{}) {
+	log.Warn().Msgf(format, args...)
+}
+
+// gormLogger reports statements slower than 200ms and errors other than
+// missing records, which handlers answer themselves.
+var gormLogger = logger.New(gormLogWriter{}, logger.Config{
+	SlowThreshold:             200 * time.Millisecond,
+	LogLevel:                  logger.Warn,
+	IgnoreRecordNotFoundError: true,
+})
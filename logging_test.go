@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestLogConfig(t *testing.T) {
+
+	env := testEnv{"DB_USER": "webapp", "DB_NAME": "webapp", "SNS_TOPIC_ARN": "arn:aws:sns:us-east-1:123456789012:submissions"}
+
+	config, err := loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, zerolog.InfoLevel, config.Log.Level)
+	assert.Equal(t, "json", config.Log.Format)
+	assert.Equal(t, []string{"file", "stdout"}, config.Log.Outputs)
+	assert.Equal(t, []string{"email"}, config.Log.RedactFields)
+	assert.Equal(t, 100, config.Log.MaxSizeMB)
+	assert.True(t, config.Log.Compress)
+
+	env["LOG_LEVEL"] = "DEBUG"
+	env["LOG_OUTPUTS"] = "stdout"
+	env["LOG_MAX_BACKUPS"] = "0"
+	env["LOG_REDACT_FIELDS"] = "none"
+	config, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, zerolog.DebugLevel, config.Log.Level)
+	assert.Equal(t, []string{"stdout"}, config.Log.Outputs)
+	assert.Equal(t, 0, config.Log.MaxBackups)
+	assert.Equal(t, []string{"none"}, config.Log.RedactFields)
+
+	env["LOG_OUTPUTS"] = "file,syslog"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, `log.outputs should list file or stdout, got "syslog"`)
+	delete(env, "LOG_OUTPUTS")
+
+	env["LOG_LEVEL"] = "trace"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, `log.level should be debug, info, warn or error, got "trace"`)
+	delete(env, "LOG_LEVEL")
+
+	env["LOG_MAX_SIZE_MB"] = "0"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, "log.max_size_mb should be at least 1, got 0")
+}
+
+func TestSetupLogging(t *testing.T) {
+
+	logger, level, path := log.Logger, zerolog.GlobalLevel(), logFilePath
+	defer func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+		logFilePath = path
+	}()
+
+	// A world writable file of an earlier version loses the extra permissions
+	file := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(file, nil, 0666))
+	require.NoError(t, os.Chmod(file, 0666))
+
+	logFile, err := setupLogging(logConfig{Level: zerolog.WarnLevel, Format: "json", Outputs: []string{"file"}, RedactFields: []string{"email"}, File: file, MaxSizeMB: 1})
+	require.NoError(t, err)
+	defer logFile.Close()
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.Equal(t, file, logFilePath)
+
+	log.Info().Msg("Below the level")
+	log.Warn().Str("email", "jane.doe@example.com").Msg("At the level")
+
+	written, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(written)), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"message":"At the level"`)
+	assert.NotContains(t, lines[0], "jane.doe@example.com")
+}
+
+func TestReopenLogFile(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, createLogFile(file))
+	logFile := &lumberjack.Logger{Filename: file, MaxSize: 1}
+	defer logFile.Close()
+	_, err := logFile.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// logrotate moves the file away, then the app reopens it under its name
+	require.NoError(t, os.Rename(file, file+".1"))
+	require.NoError(t, reopenLogFile(logFile))
+	_, err = logFile.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	written, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", string(written))
+}
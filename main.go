@@ -3,95 +3,115 @@ package main
 import (
 	"app/assignment/controllers"
 	"app/assignment/models"
+	"context"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
-	"fmt"
-	"io/ioutil"
+	"flag"
 	"strings"
 	"time"
 
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
-	statsd "github.com/etsy/statsd/examples/go"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
-	"gopkg.in/yaml.v3"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-var dbUser string = os.Getenv("DB_USER")
-var dbPassword string = os.Getenv("DB_PASSWORD")
-var dbName string = os.Getenv("DB_NAME")
-var dbHost string = os.Getenv("DB_HOST")
-var dbPort string = os.Getenv("DB_PORT")
-var snsArn string
-
 var db *gorm.DB
 var dbErr error
 
-type DbConfig struct {
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
-	DB       string `yaml:"db"`
-	SnsArn   string `yaml:"snsarn"`
-}
+// Models whose tables are created on startup
+var migratedModels = []interface{}{&models.Account{}, &models.Assignment{}, &models.Submission{}, &models.Extension{}, &models.AuditEvent{}, &models.Course{}, &models.Enrollment{}, &models.Team{}, &models.TeamMember{}, &models.RubricCriterion{}, &models.CriterionScore{}, &models.AssignmentTemplate{}, &models.AssignmentRevision{}}
+
+// Returned when an assignment with submissions is deleted without force
+var errAssignmentHasSubmissions = errors.New("ASSIGNMENT HAS SUBMISSIONS")
+
+// Returned when a submission has no retries left
+var errAttemptsExhausted = errors.New("ATTEMPTS EXHAUSTED")
+
+// Layout of the deadline string accepted on assignments
+const deadlineLayout = "2006-01-02T15:04:05.999Z"
+
 type AssignmentData struct {
 	Name string `json:"name"`
 }
 
-// Initialize the StatsD client
-var statsdClient = statsd.New("127.0.0.1", 8125)
-
 func main() {
 
-	// Open the log file for writing
-	logFile, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:], os.Getenv, os.Stdout, os.Stderr))
+	}
+
+	// Until the config is read, logs go to stderr
+	var flags configFlags
+	if err := newConfigFlagSet(os.Args[0], &flags).Parse(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+	config, err := loadConfig(flags, os.Getenv)
 	if err != nil {
-		fmt.Printf("Failed to open log file: %v\n", err)
-		log.Error().Err(err).Msg("Unable to open log file for writing logs")
-		return
+		log.Error().Err(err).Msg("Invalid configuration")
+		os.Exit(1)
 	}
-	defer logFile.Close()
 
-	// Set zerolog to write logs to the file
-	log.Logger = log.Output(logFile)
+	logConfig := config.Log
+	logFile, err := setupLogging(logConfig)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to set up the logs")
+		os.Exit(1)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
 
-	log.Info().Msg("Successfully created the log file for the webapp")
+	// gin only prints its routes when debugging
+	if logConfig.Level > zerolog.DebugLevel && os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
-	yamlFile, err := ioutil.ReadFile("/opt/dbconfig.yaml")
-	var dbconfig DbConfig
-	if err == nil {
-		println("Got File--Unmarshalling it")
-		if err := yaml.Unmarshal(yamlFile, &dbconfig); err != nil {
-			fmt.Printf("Unmrshal Unsuccessful: error=%v", err)
-			log.Error().Err(err).Msg("Unable to UNMARSHAL the given config file")
-		} else {
-			println("Setting file values into conn details from config file")
-			log.Info().Msg("Successfully read the database configuration given and setting up the values for connection")
-			//	log.Info().Msg("")
-			dbUser = dbconfig.User
-			dbPassword = dbconfig.Password
-			dbName = dbconfig.DB
-			dbHost = dbconfig.Host
-			dbPort = dbconfig.Port
-			snsArn = dbconfig.SnsArn
-		}
+	log.Info().Str("level", logConfig.Level.String()).Strs("outputs", logConfig.Outputs).Msg("Successfully set up the logs of the webapp")
+
+	appMetrics, metricsHandler, err = newMetrics(config.Metrics)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to set up the metrics")
+		os.Exit(1)
+	}
+
+	if err := setupTracing(context.Background(), config.Tracing); err != nil {
+		log.Error().Err(err).Msg("Unable to set up the traces")
+		os.Exit(1)
 	}
 
+	// Credentials referencing secrets are read from their provider
+	secrets := newSecretResolver(config.Secrets)
+
 	// Connect to DB
-	dbConn := dbUser + ":" + dbPassword + "@tcp" + "(" + dbHost + ":" + dbPort + ")/" + "?" + "parseTime=true&loc=Local"
-	db, dbErr = gorm.Open(mysql.Open(dbConn), &gorm.Config{})
+	db, _, dbErr = openDatabase(context.Background(), config.Database, false, secrets)
+	if db == nil {
+		log.Error().Err(dbErr).Msg("Unable to read the database credentials")
+		os.Exit(1)
+	}
 	if dbErr != nil {
-		log.Error().Err(err).Msg("Unable to connect to database with given connection data")
+		log.Error().Err(dbErr).Msg("Unable to connect to database with given connection data")
 	} else {
 		log.Info().Msg("Successfully connected to database")
 	}
@@ -100,39 +120,49 @@ func main() {
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to create a sql database object")
 	}
-	defer sqlDB.Close()
 
-	_, err = sqlDB.Exec("CREATE DATABASE IF NOT EXISTS " + dbName)
+	_, err = sqlDB.Exec("CREATE DATABASE IF NOT EXISTS " + config.Database.Name)
 	if err != nil {
-		log.Error().Err(err).Str("database", dbName).Msg("Failed to create the database")
+		log.Error().Err(err).Str("database", config.Database.Name).Msg("Failed to create the database")
 	} else {
-		log.Info().Str("database", dbName).Msg("Successfully created database")
+		log.Info().Str("database", config.Database.Name).Msg("Successfully created database")
 	}
+	sqlDB.Close() // the pool of the named database is opened below
 
-	dbConn = dbUser + ":" + dbPassword + "@tcp(" + dbHost + ":" + dbPort + ")/" + dbName + "?parseTime=true&loc=Local"
-	db, err = gorm.Open(mysql.Open(dbConn), &gorm.Config{})
+	var dbConnector *credentialConnector
+	db, dbConnector, err = openDatabase(context.Background(), config.Database, true, secrets)
+	if db == nil {
+		log.Error().Err(err).Msg("Unable to read the database credentials")
+		os.Exit(1)
+	}
 	if err != nil {
 
-		log.Error().Err(err).Str("database", dbName).Msg("Failed to connect to the custom-named database")
+		log.Error().Err(err).Str("database", config.Database.Name).Msg("Failed to connect to the custom-named database")
 	} else {
-		log.Info().Str("database", dbName).Msg("Successfully connected to database")
+		log.Info().Str("database", config.Database.Name).Msg("Successfully connected to database")
+	}
+
+	// Time and trace every statement
+	if err := db.Use(gormMetrics{}); err != nil {
+		log.Error().Err(err).Msg("Unable to time the database statements")
+	}
+	if err := db.Use(gormTracing{}); err != nil {
+		log.Error().Err(err).Msg("Unable to trace the database statements")
 	}
 
 	// Bootstrap db with schemas
-	db.AutoMigrate(&models.Account{}, &models.Assignment{}, &models.Submission{})
+	db.AutoMigrate(migratedModels...)
 
-	//file, err := os.Open("./config/users.csv") // Windows
-	file, err := os.Open("users.csv")
+	file, err := os.Open(config.UsersFile)
 	if err != nil {
-		println("FILE OPEN ERR")
-		log.Error().Err(err).Str("file", "users.csv").Msg("Failed to open the users file given")
+		log.Error().Err(err).Str("file", config.UsersFile).Msg("Failed to open the users file given")
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
 	// Read and discard the header line
 	_, err = reader.Read()
 	if err != nil {
-		log.Error().Err(err).Str("file", "users.csv").Msg("Unable to discard the header line from users file")
+		log.Error().Err(err).Str("file", config.UsersFile).Msg("Unable to discard the header line from users file")
 	}
 
 	for {
@@ -166,77 +196,219 @@ func main() {
 		db.Create(&acc1)
 	}
 
-	// router setup
-	router := gin.Default()
+	// SIGTERM from systemd or Ctrl+C start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// Pick up rotated database credentials without a restart
+	if config.Secrets.RefreshInterval > 0 {
+		if sqlDB, err := db.DB(); err == nil {
+			go refreshCredentials(ctx, sqlDB, dbConnector, config.Secrets.RefreshInterval)
+		}
+	}
+
+	// Publish submission notifications in the background
+	snsClient := createSNSSession(config.SNS.Region)
+	notifications = newNotifier(func(ctx context.Context, message string) error {
+		return publishToSNS(ctx, snsClient, config.SNS.TopicArn, message)
+	}, config.SNS.PublishTimeout, 100)
+	go notifications.run()
+	readinessProbes = append(readinessProbes, healthProbe{Name: "notifier", Check: func(ctx context.Context) error {
+		return checkNotifier(ctx, snsClient, config.SNS.TopicArn)
+	}})
+
+	// Reopen the log file for logrotate
+	if logFile != nil {
+		go maintainLogFile(ctx, logFile, logConfig.RotateInterval)
+	}
+
+	// Publish scheduled drafts in the background
+	scheduler := make(chan struct{})
+	go func() {
+		defer close(scheduler)
+		runPublishScheduler(ctx, time.Minute)
+	}()
 
-	router.Any("/healthz", healthCheck)
+	servers, reloaders, err := newServers(config.Server)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to set up the servers")
+		os.Exit(1)
+	}
+
+	// Pick up renewed certificates without a restart
+	for _, reloader := range reloaders {
+		go func(reloader *certReloader) {
+			if err := reloader.watch(ctx); err != nil {
+				log.Error().Err(err).Str("file", reloader.certFile).Msg("Unable to watch the TLS certificate for changes")
+			}
+		}(reloader)
+	}
+
+	serveErr := serve(ctx, servers)
+	if serveErr != nil {
+		log.Error().Err(serveErr).Msg("A server stopped unexpectedly")
+	}
+	stop() // a second signal kills the process right away
+
+	shutdown(servers, config.Server.ShutdownTimeout, scheduler)
+	if serveErr != nil {
+		os.Exit(1)
+	}
+}
 
-	router.POST("/v1/assignments", createAssignment)
+// setupRouter registers the middlewares and routes of the webapp. Routes are
+// documented in apiOperations as well.
+func setupRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(otelgin.Middleware(serviceName), requestLogMiddleware(), gin.Recovery(), metricsMiddleware(), problemMiddleware())
+	router.NoRoute(notFound)
 
-	router.GET("/v2/assignments", getAllAssignments)
+	// Wrong methods on known paths are answered with 405
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(methodNotAllowed)
 
-	router.GET("/v1/assignments/:id", getAssignment)
+	router.GET("/healthz", healthCheck)
 
-	router.PUT("/v1/assignments/:id", updateAssignment)
+	router.GET("/livez", livenessCheck)
+
+	router.GET("/readyz", readinessCheck(false))
+
+	router.GET("/metrics", getMetrics)
+
+	router.GET("/openapi.json", getOpenAPI)
+
+	router.GET("/docs", getSwaggerUI)
+
+	// v1 is kept for existing clients until its sunset, v2 renders
+	// assignments with snake_case keys and RFC 3339 timestamps
+	v1 := router.Group("/"+apiV1, apiVersion(apiV1), deprecatedAPI(apiV1Deprecated, apiV1Sunset, apiV2))
+	registerAPIRoutes(v1)
+
+	v2 := router.Group("/"+apiV2, apiVersion(apiV2))
+	registerAPIRoutes(v2)
+
+	return router
+}
 
-	router.PATCH("/v1/assignments/:id", func(c *gin.Context) {
-		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "PATCH not allowed!"})
+// registerAPIRoutes registers the routes every version of the API serves
+func registerAPIRoutes(api *gin.RouterGroup) {
+	api.POST("/assignments", createAssignment)
+
+	api.GET("/assignments", getAllAssignments)
+
+	api.GET("/assignments/export", exportAssignments)
+
+	api.POST("/assignments/import", importAssignments)
+
+	api.GET("/assignments/:id", getAssignment)
+
+	api.PUT("/assignments/:id", updateAssignment)
+
+	api.PATCH("/assignments/:id", func(c *gin.Context) {
+		abortWithProblem(c, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "PATCH not allowed!")
 	})
 
-	router.DELETE("/v1/assignments/:id", deleteAssignment)
+	api.DELETE("/assignments/:id", deleteAssignment)
+
+	api.POST("/assignments/:id/submission", submitAssignment)
+
+	api.POST("/assignments/:id/submissions/:submissionId/grade", gradeSubmission)
+
+	api.POST("/assignments/:id/teams", createTeam)
+
+	api.GET("/assignments/:id/teams", getTeams)
+
+	api.DELETE("/assignments/:id/teams/:teamId", deleteTeam)
+
+	api.POST("/assignments/:id/teams/:teamId/join", joinTeam)
+
+	api.POST("/assignments/:id/teams/:teamId/leave", leaveTeam)
+
+	api.POST("/assignments/:id/publish", transitionAssignment(models.AssignmentStatusPublished))
+
+	api.POST("/assignments/:id/close", transitionAssignment(models.AssignmentStatusClosed))
+
+	api.POST("/assignments/:id/archive", transitionAssignment(models.AssignmentStatusArchived))
 
-	router.POST("/v1/assignments/:id/submission", submitAssignment)
+	api.GET("/assignments/:id/gradebook", getAssignmentGradebook)
 
-	router.Run()
+	api.POST("/assignments/:id/extensions", grantExtension)
 
+	api.GET("/assignments/:id/extensions", getExtensions)
+
+	api.DELETE("/assignments/:id/extensions/:extensionId", revokeExtension)
+
+	api.GET("/gradebook", getGradebook)
+
+	api.POST("/assignments/:id/clone", cloneAssignment)
+
+	api.GET("/assignments/:id/revisions", getRevisions)
+
+	api.POST("/assignments/:id/revisions/:revision/restore", revertAssignment)
+
+	api.POST("/assignments/:id/restore", restoreAssignment)
+
+	api.POST("/templates", createTemplate)
+
+	api.GET("/templates", getTemplates)
+
+	api.GET("/templates/:id", getTemplate)
+
+	api.DELETE("/templates/:id", deleteTemplate)
+
+	api.POST("/templates/:id/instantiate", instantiateTemplate)
+
+	api.POST("/courses", createCourse)
+
+	api.GET("/courses", getCourses)
+
+	api.GET("/courses/:id", getCourse)
+
+	api.POST("/courses/:id/enrollments", enrollAccount)
+
+	api.GET("/courses/:id/enrollments", getEnrollments)
+
+	api.POST("/courses/:id/enrollments/import", importEnrollments)
+
+	api.DELETE("/courses/:id/enrollments/:enrollmentId", unenrollAccount)
 }
 
 func healthCheck(c *gin.Context) {
 
 	// Increment the counter metric every time the API is hit
-	statsdClient.Increment("healthz_counter")
+	appMetrics.Count("healthz_counter")
 
 	// Set Cache Control
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("Healthz Endpoint")
+	requestLogger(c).Info().Msg("Healthz Endpoint")
 
 	// Check for http method
 	if c.Request.Method != http.MethodGet {
-		c.Status((http.StatusMethodNotAllowed))
 		err := errors.New("METHOD NOT ALLOWD")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("Healthz Endpoint:Wrong Method")
+		requestLogger(c).Error().Err(err).Msg("Healthz Endpoint:Wrong Method")
+		abortWithProblem(c, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Only GET is allowed")
 		return
 	}
 
 	// Payload Check
 	if c.Request.ContentLength > 0 {
-		c.Status(http.StatusBadRequest)
 		err := errors.New("PAYLOAD NOT ALLOWED")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("Healthz Endpoint:Content length greater than zero")
+		requestLogger(c).Error().Err(err).Msg("Healthz Endpoint:Content length greater than zero")
+		abortWithProblem(c, http.StatusBadRequest, "PAYLOAD_NOT_ALLOWED", "Health checks don't take a payload")
 		return
 	}
 
-	// Connection String
-	dbConn := dbUser + ":" + dbPassword + "@tcp" + "(" + dbHost + ":" + dbPort + ")/" + dbName + "?" + "parseTime=true&loc=Local"
-	fmt.Println("DB Connection String ", dbConn)
-	dbHealth, dbConnErr := gorm.Open(mysql.Open(dbConn), &gorm.Config{})
-	fmt.Printf("DB Connection Status: error=%v", dbConnErr)
-	sqlDB, err := dbHealth.DB()
-	if err != nil {
-		log.Error().Err(err).Msg("Healthz Endpoint:Unable to create a sql database object")
-	}
-	defer sqlDB.Close()
-
-	// DB Connection Check
-	if dbConnErr != nil {
-		err := errors.New("DATABASE CONNECTION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("Healthz Endpoint:Unable to connect to database")
+	// Ping the shared pool
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+	if err := checkDatabase(ctx); err != nil {
+		requestLogger(c).Error().Err(err).Msg("Healthz Endpoint:Unable to connect to database")
 		c.Status(http.StatusServiceUnavailable)
 	} else {
-		log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("Healthz Endpoint:Successfully connected to database")
+		requestLogger(c).Info().Msg("Healthz Endpoint:Successfully connected to database")
 		c.Status(http.StatusOK)
 	}
 
@@ -245,21 +417,20 @@ func healthCheck(c *gin.Context) {
 func createAssignment(c *gin.Context) {
 
 	// Increment the counter metric every time the API is hit
-	statsdClient.Increment("createassignment_counter")
+	appMetrics.Count("createassignment_counter")
 
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint")
+	requestLogger(c).Info().Msg("CreateAssignment Endpoint")
 
 	var assignmentInput models.AssignmentInput
 
-	// Bind the request body to the `assignmentInput` struct
-	if err := c.BindJSON(&assignmentInput); err != nil {
-		err := errors.New("INCORRECT REQUEST BODY")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint:The request body is incorrect")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Bind and validate the request body to the `assignmentInput` struct
+	if err := validateFutureDeadline(&assignmentInput, c.ShouldBindJSON(&assignmentInput)); err != nil {
+		requestLogger(c).Error().Err(err).Msg("CreateAssignment Endpoint:The request body is incorrect")
+		abortWithInvalidInput(c, "INVALID_ASSIGNMENT", err)
 		return
 	}
 	// Authenticate the user and obtain their user ID
@@ -267,119 +438,106 @@ func createAssignment(c *gin.Context) {
 	userID, err := controllers.AuthenticateUser(c, db)
 	if err != nil {
 		err := errors.New("AUTHENTICATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint:Unable to authenticate the request")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication Failed!"})
+		requestLogger(c).Error().Err(err).Msg("CreateAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
 		return
 	}
 
-	//Max Point CriteriaCheck
-	if assignmentInput.Points <=
-		0 || assignmentInput.Points > 100 {
-		err := errors.New("ASSIGNMENT POINTS ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint:Assignment Points should be between 1 and 100")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Assignment Points should be between 1 and 100"})
+	// Late policy, team settings, rubric and publish date CriteriaCheck
+	if err := validateAssignmentInput(&assignmentInput); err != nil {
+		requestLogger(c).Error().Err(err).Msg("CreateAssignment Endpoint:The assignment is invalid")
+		abortWithInvalidInput(c, "INVALID_ASSIGNMENT", err)
 		return
 	}
 
-	// NoOfPOints CriteriaCheck
-	if assignmentInput.NoOfAttempts <=
-		0 || assignmentInput.NoOfAttempts > 100 {
-		err := errors.New("NUMBER OF ATTEMPTS ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint:No of attempts should be between 1 and 100")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No of attempts should be between 1 and 100"})
+	// Only instructors of a course can add assignments to it
+	courseID, err := assignmentCourse(requestDB(c), assignmentInput.CourseID, userID)
+	if errors.Is(err, errCourseRequired) {
+		requestLogger(c).Error().Err(err).Msg("CreateAssignment Endpoint:The course of the assignment is missing")
+		abortWithProblem(c, http.StatusBadRequest, "COURSE_REQUIRED", "An assignment needs the ID of its course")
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error().Err(err).Msg("CreateAssignment Endpoint:The user is not an instructor of the course")
+		abortWithProblem(c, http.StatusForbidden, "NOT_COURSE_INSTRUCTOR", "You are not an instructor of this course")
 		return
 	}
 
 	// Set the UserID field in the Assignment struct
-	newAssignment := models.Assignment{
-		Name:         assignmentInput.Name,
-		Points:       assignmentInput.Points,
-		NoOfAttempts: assignmentInput.NoOfAttempts,
-		Deadline:     assignmentInput.Deadline,
-		AccountID:    userID,
-	}
+	newAssignment := newAssignmentFromInput(assignmentInput, userID, courseID)
 
 	// Create a new assignment record in the database
-	result := db.Create(&newAssignment)
-	if result.Error != nil {
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newAssignment).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, userID, revisionCreate, newAssignment)
+	})
+	if err != nil {
 		err := errors.New("ASSIGNMENT CREATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint:An error occured while creating a new assignment")
-		c.JSON(http.StatusExpectationFailed, gin.H{"error": "An error occured while creating a new assignment"})
+		requestLogger(c).Error().Err(err).Msg("CreateAssignment Endpoint:An error occured while creating a new assignment")
+		abortWithProblem(c, http.StatusInternalServerError, "ASSIGNMENT_CREATION_ERROR", "An error occured while creating a new assignment")
+		return
 	}
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("CreateAssignment Endpoint:Successfully created the assignment")
+	requestLogger(c).Info().Msg("CreateAssignment Endpoint:Successfully created the assignment")
 
-	c.JSON(http.StatusCreated, assignmentInput)
+	renderAssignment(c, http.StatusCreated, newAssignment)
 
 }
 
 func getAllAssignments(c *gin.Context) {
 
 	// Increment the counter metric every time the API is hit
-	statsdClient.Increment("getallassignments_counter")
+	appMetrics.Count("getallassignments_counter")
 
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAllAssignments Endpoint")
+	requestLogger(c).Info().Msg("GetAllAssignments Endpoint")
 
 	// Authenticate the user and obtain their user ID
 
-	_, err := controllers.AuthenticateUser(c, db)
+	userID, err := controllers.AuthenticateUser(c, db)
 	if err != nil {
 		err := errors.New("AUTHENTICATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAllAssignments Endpoint:Unable to authenticate the request")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication Failed!"})
+		requestLogger(c).Error().Err(err).Msg("GetAllAssignments Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
 		return
 	}
 
-	// Query the database to retrieve all assignments
+	// Query the database to retrieve the assignments visible to the caller
 	var assignments []models.Assignment
-	if err := db.Find(&assignments).Error; err != nil {
+	if err := visibleAssignments(withRubric(requestDB(c)), userID).Find(&assignments).Error; err != nil {
 		err := errors.New("ASSIGNMENT RETRIEVAL ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAllAssignments Endpoint:Unable to retrieve errrors from database")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		requestLogger(c).Error().Err(err).Msg("GetAllAssignments Endpoint:Unable to retrieve assignments from database")
+		abortWithProblem(c, http.StatusInternalServerError, "ASSIGNMENT_RETRIEVAL_ERROR", "Unable to retrieve assignments from database")
 		return
 	}
 
-	var assignmentResponses []models.AssignmentResponse
-
-	for _, ass := range assignments {
-		assResp := models.AssignmentResponse{
-			ID:                ass.ID,
-			Name:              ass.Name,
-			Deadline:          ass.Deadline,
-			Points:            ass.Points,
-			NoOfAttempts:      ass.NoOfAttempts,
-			AssignemtCreated:  ass.CreatedAt.String(),
-			AssignmentUpdated: ass.UpdatedAt.String(),
-		}
-		assignmentResponses = append(assignmentResponses, assResp)
-	}
-
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAllAssignments Endpoint:Successfully retrieved all assignments")
+	requestLogger(c).Info().Msg("GetAllAssignments Endpoint:Successfully retrieved all assignments")
 
 	// Return the list of assignments as a JSON response
-	c.JSON(http.StatusOK, assignmentResponses)
+	c.JSON(http.StatusOK, assignmentResponses(c, assignments))
 }
 
 func getAssignment(c *gin.Context) {
 
 	// Increment the counter metric every time the API is hit
-	statsdClient.Increment("getanassignment_counter")
+	appMetrics.Count("getanassignment_counter")
 
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAnAssignment Endpoint")
+	requestLogger(c).Info().Msg("GetAnAssignment Endpoint")
 
-	_, err := controllers.AuthenticateUser(c, db)
+	userID, err := controllers.AuthenticateUser(c, db)
 	if err != nil {
 		err := errors.New("AUTHENTICATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAnAssignment Endpoint:Unable to authenticate the request")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication Failed!"})
+		requestLogger(c).Error().Err(err).Msg("GetAnAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
 		return
 	}
 
@@ -389,54 +547,52 @@ func getAssignment(c *gin.Context) {
 	id, err := strconv.ParseUint(assID, 10, 64)
 	if err != nil {
 		err := errors.New("INVALID ASSIGNMENT ID")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAnAssignment Endpoint:The assignment ID is Invalid")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		requestLogger(c).Error().Err(err).Msg("GetAnAssignment Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
 		return
 	}
 
 	// Query the database to find the assignment by ID
 	var assignment models.Assignment
-	if err := db.First(&assignment, id).Error; err != nil {
+	if err := withRubric(requestDB(c)).First(&assignment, id).Error; err != nil {
 		if gorm.ErrRecordNotFound == err {
 			err := errors.New("ASSIGNMENT NOT FOUND")
-			log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAnAssignment Endpoint:The assignment doesn't exist")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			requestLogger(c).Error().Err(err).Msg("GetAnAssignment Endpoint:The assignment doesn't exist")
+			abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
 			return
 		}
 	}
 
-	assResp := models.AssignmentResponse{
-		ID:                assignment.ID,
-		Name:              assignment.Name,
-		Deadline:          assignment.Deadline,
-		Points:            assignment.Points,
-		NoOfAttempts:      assignment.NoOfAttempts,
-		AssignemtCreated:  assignment.CreatedAt.String(),
-		AssignmentUpdated: assignment.UpdatedAt.String(),
+	// Unpublished assignments and assignments of other courses are hidden
+	if !canViewAssignment(requestDB(c), assignment, userID) {
+		err := errors.New("ASSIGNMENT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("GetAnAssignment Endpoint:The assignment isn't visible to the user")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+		return
 	}
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("GetAnAssignment Endpoint:Successfullt retrieved the assignment")
+	requestLogger(c).Info().Msg("GetAnAssignment Endpoint:Successfullt retrieved the assignment")
 	// Return the assignment as a JSON response
-	c.JSON(http.StatusOK, assResp)
+	renderAssignment(c, http.StatusOK, assignment)
 }
 
 func deleteAssignment(c *gin.Context) {
 
 	// Increment the counter metric every time the API is hit
-	statsdClient.Increment("deleteassignment_counter")
+	appMetrics.Count("deleteassignment_counter")
 
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint")
+	requestLogger(c).Info().Msg("DeleteAssignment Endpoint")
 
 	// Authenticate the user and obtain their user ID
 	userID, err := controllers.AuthenticateUser(c, db)
 	if err != nil {
 		err := errors.New("AUTHENTICATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint:Unable to authenticate the request")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		requestLogger(c).Error().Err(err).Msg("DeleteAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
 		return
 	}
 
@@ -446,17 +602,17 @@ func deleteAssignment(c *gin.Context) {
 	id, err := strconv.Atoi(assignmentID)
 	if err != nil {
 		err := errors.New("INVALID ASSIGNMENT ID")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint:The assignment ID is Invalid")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		requestLogger(c).Error().Err(err).Msg("DeleteAssignment Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
 		return
 	}
 
 	var assignment models.Assignment
-	if err := db.First(&assignment, id).Error; err != nil {
+	if err := requestDB(c).First(&assignment, id).Error; err != nil {
 		if gorm.ErrRecordNotFound == err {
 			err := errors.New("ASSIGNMENT NOT FOUND")
-			log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint:The assignment doesn't exist")
-			c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+			requestLogger(c).Error().Err(err).Msg("DeleteAssignment Endpoint:The assignment doesn't exist")
+			abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
 			return
 		}
 	}
@@ -464,19 +620,78 @@ func deleteAssignment(c *gin.Context) {
 	// Check if the authenticated user is the owner of the assignment
 	if assignment.AccountID != userID {
 		err := errors.New("AUTHORIZATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint:The user is not authorized to delete this assignment")
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to delete this assignment"})
+		requestLogger(c).Error().Err(err).Msg("DeleteAssignment Endpoint:The user is not authorized to delete this assignment")
+		abortWithProblem(c, http.StatusForbidden, "AUTHORIZATION_ERROR", "You are not authorized to delete this assignment")
+		return
+	}
+
+	force, err := strconv.ParseBool(c.DefaultQuery("force", "false"))
+	if err != nil {
+		err := errors.New("INVALID QUERY PARAMETER")
+		requestLogger(c).Error().Err(err).Msg("DeleteAssignment Endpoint:The force parameter is invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_QUERY_PARAMETER", "force should be true or false")
 		return
 	}
 
-	if err := db.Delete(&assignment).Error; err != nil {
+	// Students' work is only deleted along with the assignment when asked for.
+	// The submissions are locked so that none can be added until the
+	// assignment is deleted.
+	deleteResp := models.DeleteAssignmentResponse{AssignmentID: assignment.ID, Submissions: []uint{}}
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&models.Submission{}).
+			Where("assignment_id = ?", assignment.ID).Order("id").Pluck("id", &deleteResp.Submissions).Error
+		if err != nil {
+			return err
+		}
+		if len(deleteResp.Submissions) > 0 && !force {
+			return errAssignmentHasSubmissions
+		}
+
+		if err := tx.Delete(&assignment).Error; err != nil {
+			return err
+		}
+
+		// The rows of the assignment share its deletion time so that
+		// restoring the assignment brings them back as well
+		var deleted models.Assignment
+		if err := tx.Unscoped().Select("deleted_at").Take(&deleted, assignment.ID).Error; err != nil {
+			return err
+		}
+		deleteResp.CascadedRows, err = setAssignmentRowsDeletedAt(tx, assignment.ID, gorm.DeletedAt{}, deleted.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		if err := recordRevision(tx, userID, revisionDelete, assignment); err != nil {
+			return err
+		}
+		return recordAudit(tx, userID, "assignment.delete", "assignment", assignment.ID, deleteResp)
+	})
+	if err == errAssignmentHasSubmissions {
+		requestLogger(c).Error().Err(err).Int("submissions", len(deleteResp.Submissions)).Msg("DeleteAssignment Endpoint:The assignment has submissions")
+		abortWithError(c, &problemError{
+			Status:      http.StatusConflict,
+			Code:        "ASSIGNMENT_HAS_SUBMISSIONS",
+			Detail:      "Assignment has " + strconv.Itoa(len(deleteResp.Submissions)) + " submissions, delete it with force=true to delete them as well",
+			Submissions: deleteResp.Submissions,
+		})
+		return
+	}
+	if err != nil {
 		err := errors.New("DELETE ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint:Failed to delete the assignment")
-		c.JSON(http.StatusExpectationFailed, gin.H{"error": "Failed to delete the assignment"})
+		requestLogger(c).Error().Err(err).Msg("DeleteAssignment Endpoint:Failed to delete the assignment")
+		abortWithProblem(c, http.StatusInternalServerError, "DELETE_ERROR", "Failed to delete the assignment")
 		return
 	}
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("DeleteAssignment Endpoint:Successfully deleted the assignment")
+	requestLogger(c).Info().Int("submissions", len(deleteResp.Submissions)).Msg("DeleteAssignment Endpoint:Successfully deleted the assignment")
+
+	// A forced deletion reports the submissions and other rows deleted along
+	// with the assignment
+	if len(deleteResp.Submissions) > 0 {
+		c.JSON(http.StatusOK, deleteResp)
+		return
+	}
 
 	c.JSON(http.StatusNoContent, gin.H{"message": "Assignment deleted successfully"})
 
@@ -485,20 +700,20 @@ func deleteAssignment(c *gin.Context) {
 func updateAssignment(c *gin.Context) {
 
 	// Increment the counter metric every time the API is hit
-	statsdClient.Increment("updateassignment_counter")
+	appMetrics.Count("updateassignment_counter")
 
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint")
+	requestLogger(c).Info().Msg("UpdateAssignment Endpoint")
 
 	// Authenticate the user and obtain their user ID
 	userID, err := controllers.AuthenticateUser(c, db)
 	if err != nil {
 		err := errors.New("AUTHENTICATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:Unable to authenticate the request")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Failed"})
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
 		return
 	}
 
@@ -507,64 +722,88 @@ func updateAssignment(c *gin.Context) {
 	assignmentID, err := strconv.ParseUint(assignmentIDStr, 10, 64)
 	if err != nil {
 		err := errors.New("INVALID ASSIGNMENT ID")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:The assignment ID is Invalid")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
 		return
 	}
 
 	// Check if the assignment exists and retrieve its owner's UserID
 	var assignment models.Assignment
-	if err := db.Where("id = ?", assignmentID).First(&assignment).Error; err != nil {
+	if err := withRubric(requestDB(c)).Where("id = ?", assignmentID).First(&assignment).Error; err != nil {
 		err := errors.New("ASSIGNMENT NOT FOUND")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:The assignment doesn't exist")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:The assignment doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
 		return
 	}
 
 	// Check if the authenticated user is the owner of the assignment
 	if assignment.AccountID != userID {
 		err := errors.New("AUTHORIZATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:The user is not authorized to delete this assignment")
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to update this assignment"})
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:The user is not authorized to delete this assignment")
+		abortWithProblem(c, http.StatusForbidden, "AUTHORIZATION_ERROR", "You are not authorized to update this assignment")
 		return
 	}
 
-	// Bind the request body to the `AssignmentInput` struct
+	// Bind and validate the request body to the `AssignmentInput` struct
 	var input models.AssignmentInput
-	if err := c.BindJSON(&input); err != nil {
-		err := errors.New("INCORRECT REQUEST BODY")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:The request body is incorrect")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	err = c.ShouldBindJSON(&input)
+	if input.Deadline != assignment.Deadline {
+		// A deadline that has passed can be kept while editing other fields
+		err = validateFutureDeadline(&input, err)
+	}
+	if err != nil {
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:The request body is incorrect")
+		abortWithInvalidInput(c, "INVALID_ASSIGNMENT", err)
+		return
+	}
+
+	// Late policy, team settings, rubric and publish date CriteriaCheck, the
+	// rubric kept from before having to match the new points as well
+	validated := input
+	if validated.Rubric == nil {
+		for _, criterion := range assignment.Rubric {
+			validated.Rubric = append(validated.Rubric, models.RubricCriterionInput{Name: criterion.Name, Weight: criterion.Weight, Levels: criterion.Levels})
+		}
+	}
+	if err := validateAssignmentInput(&validated); err != nil {
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:The assignment is invalid")
+		abortWithInvalidInput(c, "INVALID_ASSIGNMENT", err)
 		return
 	}
+	validated.Rubric = input.Rubric // nil keeps the rubric
+	input = validated
+	publishAt, _ := parsePublishAt(input.PublishAt)
 
 	// Update the assignment fields with the input data
-	assignment.Name = input.Name
-	assignment.Points = input.Points
-	assignment.NoOfAttempts = input.NoOfAttempts
-	assignment.Deadline = input.Deadline
+	applyAssignmentInput(&assignment, input, publishAt)
 
-	// Save the updated assignment to the database
-	if err := db.Save(&assignment).Error; err != nil {
-		err := errors.New("DELETE ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:Failed to update the assignment")
-		c.JSON(http.StatusExpectationFailed, gin.H{"error": "Failed to update the assignment"})
+	// Save the updated assignment and its rubric to the database
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Rubric").Save(&assignment).Error; err != nil {
+			return err
+		}
+		if input.Rubric != nil {
+			if err := replaceRubric(tx, &assignment, input.Rubric); err != nil {
+				return err
+			}
+		}
+		return recordRevision(tx, userID, revisionUpdate, assignment)
+	})
+	if err == errRubricInUse {
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:The rubric is already used to grade submissions")
+		abortWithProblem(c, http.StatusConflict, "RUBRIC_IN_USE", "The rubric can't be changed once submissions have been graded with it")
 		return
 	}
-
-	assResp := models.AssignmentResponse{
-		ID:                assignment.ID,
-		Name:              assignment.Name,
-		Points:            assignment.Points,
-		Deadline:          assignment.Deadline,
-		NoOfAttempts:      assignment.NoOfAttempts,
-		AssignemtCreated:  assignment.CreatedAt.String(),
-		AssignmentUpdated: assignment.UpdatedAt.String(),
+	if err != nil {
+		err := errors.New("UPDATE ERROR")
+		requestLogger(c).Error().Err(err).Msg("UpdateAssignment Endpoint:Failed to update the assignment")
+		abortWithProblem(c, http.StatusInternalServerError, "UPDATE_ERROR", "Failed to update the assignment")
+		return
 	}
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("UpdateAssignment Endpoint:Successfully updated the assignment")
+	requestLogger(c).Info().Msg("UpdateAssignment Endpoint:Successfully updated the assignment")
 
-	c.JSON(http.StatusOK, assResp)
+	renderAssignment(c, http.StatusOK, assignment)
 }
 
 func submitAssignment(c *gin.Context) {
@@ -573,14 +812,14 @@ func submitAssignment(c *gin.Context) {
 	c.Header("Pragma", "no-cache")
 	c.Header("X-Content-Type-Options", "nosniff")
 
-	log.Info().Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("SubmitAssignment Endpoint")
+	requestLogger(c).Info().Msg("SubmitAssignment Endpoint")
 
 	// Authenticate the user and obtain their user ID
 	userID, err := controllers.AuthenticateUser(c, db)
 	if err != nil {
 		err := errors.New("AUTHENTICATION ERROR")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("SubmitAssignment Endpoint:Unable to authenticate the request")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization Failed"})
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
 		return
 	}
 
@@ -589,214 +828,435 @@ func submitAssignment(c *gin.Context) {
 	assignmentID, err := strconv.ParseUint(assignmentIDStr, 10, 64)
 	if err != nil {
 		err := errors.New("INVALID ASSIGNMENT ID")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("SubmitAssignment Endpoint:The assignment ID is Invalid")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
 		return
 	}
 
 	// Check if the assignment exists
 	var assignment models.Assignment
-	if err := db.Where("id = ?", assignmentID).First(&assignment).Error; err != nil {
+	if err := requestDB(c).Where("id = ?", assignmentID).First(&assignment).Error; err != nil {
+		err := errors.New("ASSIGNMENT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The assignment doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+		return
+	}
+
+	// Assignments the student can't see, such as drafts or assignments of
+	// courses they don't attend, are reported as missing
+	if !canViewAssignment(requestDB(c), assignment, userID) {
 		err := errors.New("ASSIGNMENT NOT FOUND")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("SubmitAssignment Endpoint:The assignment doesn't exist")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The assignment isn't visible to the user")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+		return
+	}
+
+	// Only published assignments accept submissions
+	if assignment.Status != models.AssignmentStatusPublished {
+		err := errors.New("ASSIGNMENT NOT OPEN")
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The assignment is not open for submissions")
+		abortWithProblem(c, http.StatusNotAcceptable, "ASSIGNMENT_NOT_OPEN", "Assignment is not open for submissions")
+		return
+	}
+
+	// Apply the deadline and attempts granted to this student, if any
+	assignment, err = effectiveAssignment(requestDB(c), assignment, userID)
+	if err != nil {
+		err := errors.New("EXTENSION RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:Unable to retrieve the extension of the student")
+		abortWithProblem(c, http.StatusInternalServerError, "EXTENSION_RETRIEVAL_ERROR", "Unable to retrieve the extension of the student")
 		return
 	}
 
 	// Validate Req Body contains URL
 	var submissionInput models.SubmissionInput
 	if err := c.ShouldBindJSON(&submissionInput); err != nil {
-		err := errors.New("INCORRECT REQUEST BODY")
-		log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("SubmitAssignment Endpoint:The request body is incorrect")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The request body is incorrect")
+		abortWithInvalidInput(c, "INVALID_SUBMISSION", err)
 		return
 	}
 
-	// Check if submission already exists for the given assignment ID
-	var existingSubmission models.Submission
-
-	// SNS Client and Topic Creation
-	snsClient := createSNSSession()
-	topicArn := snsArn
-
-	result := db.Where("assignment_id = ? AND account_id = ?", assignmentID, userID).First(&existingSubmission)
-	if result.RowsAffected > 0 { // Submission already exists
-		println("**************Submission exists")
-		// Compare retries
-		if assignment.NoOfAttempts == existingSubmission.SubmissionRetries {
-			c.JSON(http.StatusNotAcceptable, gin.H{"error": "Maximum no of attempts reached! No more retries available"})
+	// Team assignments share a single submission between the members of a team
+	userEmail, _, _ := c.Request.BasicAuth()
+	recipients := []string{userEmail}
+	var team *models.Team
+	if assignment.TeamMode != "" {
+		team, err = findTeamOf(requestDB(c), assignment.ID, userID)
+		if err != nil {
+			err := errors.New("TEAM NOT FOUND")
+			requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The user is not a member of a team")
+			abortWithProblem(c, http.StatusNotAcceptable, "NOT_IN_TEAM", "You need to be a member of a team to submit this assignment")
 			return
 		}
+		recipients = team.MemberEmails()
+	}
 
-		//Compare date
-
-		// Parse the deadline string into a time.Time object
-		deadlineTime, err := time.Parse("2006-01-02T15:04:05.999Z", assignment.Deadline)
+	// The submission is read, checked and written while the team, or the
+	// account when submitting alone, is locked, so concurrent submissions
+	// share a single row and attempt counter
+	currentTime := time.Now().UTC()
+	var submission models.Submission
+	var retried bool
+	submit := func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("assignment_id = ?", assignmentID)
+		if team != nil {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Team{}, team.ID).Error; err != nil {
+				return err
+			}
+			query = query.Where("team_id = ?", team.ID)
+		} else {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Account{}, userID).Error; err != nil {
+				return err
+			}
+			query = query.Where("account_id = ?", userID)
+		}
 
-		if err != nil {
-			println("------------------------------DATE PARSE ERR", err.Error())
-			c.JSON(400, gin.H{"error": "Error parsing deadline date"})
-			return
+		submission = models.Submission{}
+		result := query.Limit(1).Find(&submission)
+		if result.Error != nil {
+			return result.Error
 		}
-		currentTime := time.Now().UTC()
-		// Compare the current time with the assignment deadline
-		if currentTime.After(deadlineTime) {
-			c.JSON(http.StatusNotAcceptable, gin.H{"error": "Assignment deadline has passed"})
-			return
+		retried = result.RowsAffected > 0
+
+		// Compare retries
+		if retried && submission.SubmissionRetries >= assignment.NoOfAttempts {
+			return errAttemptsExhausted
 		}
 
-		existingSubmission.SubmissionRetries++
-		existingSubmission.SubmissionUrl = submissionInput.SubmissionUrl
-		// Save the updated assignment to the database
-		if err := db.Save(&existingSubmission).Error; err != nil {
-			err := errors.New("UPDATE ERROR")
-			log.Error().Err(err).Str("ip", c.ClientIP()).Str("http_method", c.Request.Method).Msg("SubmitAssignment Endpoint:Failed to update the assignment")
-			c.JSON(http.StatusExpectationFailed, gin.H{"error": "Failed to update the assignment submission"})
-			return
+		// Apply the late policy of the assignment
+		isLate, latePenalty, err := evaluateLatePolicy(assignment, assignment.Deadline, currentTime)
+		if err != nil {
+			return err
 		}
 
-		subResp := models.SubmissionResponse{
-			ID:                existingSubmission.ID,
-			AssignmentID:      assignment.ID,
-			SubmissionUrl:     submissionInput.SubmissionUrl,
-			SubmissionDate:    existingSubmission.UpdatedAt.String(),
-			SubmissionRetries: existingSubmission.SubmissionRetries,
+		if !retried {
+			requestLogger(c).Debug().Msg("SubmitAssignment Endpoint:Creating a new submission")
+			submission = models.Submission{
+				AssignmentID:      assignmentID,
+				AccountID:         userID,
+				SubmissionUrl:     submissionInput.SubmissionUrl,
+				SubmissionRetries: 1,
+				TeamID:            teamID(team),
+				IsLate:            isLate,
+				LatePenalty:       latePenalty,
+			}
+			return tx.Create(&submission).Error
 		}
 
-		c.JSON(http.StatusOK, subResp)
+		requestLogger(c).Debug().Uint("submission", submission.ID).Msg("SubmitAssignment Endpoint:Retrying an existing submission")
+		submission.SubmissionRetries++
+		submission.SubmissionUrl = submissionInput.SubmissionUrl
+		submission.AccountID = userID // last member of the team to submit
+		submission.IsLate = isLate
+		submission.LatePenalty = latePenalty
+		return tx.Save(&submission).Error
+	}
 
-		assName := assignment.Name
-		retry := strconv.Itoa(subResp.SubmissionRetries)
-		subTime := currentTime.String()
-		userEmail, _, _ := c.Request.BasicAuth()
-		subEmail := userEmail
-		downloadURL := subResp.SubmissionUrl
-		var uName string
+	err = requestDB(c).Transaction(submit)
+	if isDuplicateEntry(err) {
+		// Created by a concurrent request in between, retried on that row
+		err = requestDB(c).Transaction(submit)
+	}
+	switch {
+	case err == errAttemptsExhausted:
+		abortWithProblem(c, http.StatusNotAcceptable, "ATTEMPTS_EXHAUSTED", "Maximum no of attempts reached! No more retries available")
+		return
+	case err == errDeadlineParse:
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:Unable to parse the deadline of the assignment")
+		abortWithProblem(c, http.StatusBadRequest, "DEADLINE_PARSE_ERROR", "Error parsing deadline date")
+		return
+	case err == errDeadlinePassed:
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:The late policy doesn't accept more submissions")
+		abortWithProblem(c, http.StatusNotAcceptable, "DEADLINE_PASSED", "Assignment deadline has passed")
+		return
+	case err != nil:
+		err := errors.New("UPDATE ERROR")
+		requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:Failed to save the submission")
+		abortWithProblem(c, http.StatusInternalServerError, "UPDATE_ERROR", "Failed to save the assignment submission")
+		return
+	}
 
-		// Split the email address by "@" to separate the username and domain
-		parts := strings.Split(subEmail, "@")
+	subResp := models.SubmissionResponse{
+		ID:                submission.ID,
+		AssignmentID:      assignment.ID,
+		SubmissionUrl:     submissionInput.SubmissionUrl,
+		SubmissionDate:    submission.UpdatedAt.String(),
+		SubmissionRetries: submission.SubmissionRetries,
+		IsLate:            submission.IsLate,
+		LatePenalty:       submission.LatePenalty,
+	}
 
-		// Check if the split resulted in two parts
-		if len(parts) == 2 {
-			// The username is the first part before "@"
-			uName = parts[0]
+	countSubmission(submission.IsLate)
 
-			// Print the result
-			fmt.Println(uName)
-		}
+	c.JSON(http.StatusOK, subResp)
 
-		message1 := fmt.Sprintf(`{"name": "%s", "assName": "%s", "retry": "%s", "email": "%s", "time": "%s", "downloadURL": "%s"}`, uName, assName, retry, subEmail, subTime, downloadURL)
-		fmt.Println("******************************")
-		fmt.Println(message1)
-		fmt.Println("******************************")
+	notifySubmission(c, assignment, subResp, recipients, currentTime)
+}
 
-		err = publishToSNS(snsClient, topicArn, message1)
-		if err != nil {
-			fmt.Print("***************************PUBLISH ERRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRR", err.Error())
-			log.Error().Err(err).Msg(err.Error())
-			//	return
-		} else {
-			fmt.Print("FMT___________________PUBLISHED SUCCESSFULLY TO SNS Resubmission")
-			log.Info().Msg("Published successfully to sns from Resubmission")
-		}
+// validateAssignmentInput applies the rules every new or changed assignment
+// has to follow, filling in the defaults of optional settings.
+func validateAssignmentInput(input *models.AssignmentInput) error {
+	// Name, points, attempts and dates CriteriaCheck, declared on the input
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		return err
+	}
 
-		return
+	if err := validateLatePolicy(input); err != nil {
+		return err
+	}
+	if err := validateTeamSettings(input); err != nil {
+		return err
+	}
+	if err := validateRubric(input); err != nil {
+		return err
+	}
 
-	} else {
-		println("*submssn dosent exist-----Create new submission")
-		// Compare date
-		// Parse the deadline string into a time.Time object
-		deadlineTime, err := time.Parse("2006-01-02T15:04:05.999Z", assignment.Deadline)
+	_, err := parsePublishAt(input.PublishAt)
+	return err
+}
 
-		if err != nil {
-			println("------------------------------DATE PARSE ERR", err.Error())
-			c.JSON(400, gin.H{"error": "Error parsing deadline date"})
-			return
-		}
-		currentTime := time.Now().UTC()
-		// Compare the current time with the assignment deadline
-		if currentTime.After(deadlineTime) {
-			c.JSON(http.StatusNotAcceptable, gin.H{"error": "Assignment deadline has passed"})
-			return
-		}
+// Returned by assignmentCourse when no course is given
+var errCourseRequired = errors.New("COURSE REQUIRED")
 
-		// Create a submission
+// assignmentCourse checks that the account can add assignments to the course.
+// Every new assignment belongs to a course, only assignments created before
+// courses existed have none.
+func assignmentCourse(tx *gorm.DB, courseID uint, userID uint) (*uint, error) {
+	if courseID == 0 {
+		return nil, errCourseRequired
+	}
 
-		newSubmission := models.Submission{
-			AssignmentID:      assignmentID,
-			AccountID:         userID,
-			SubmissionUrl:     submissionInput.SubmissionUrl,
-			SubmissionRetries: 1, // Set other fields as needed
-		}
+	if enrollmentRole(tx, courseID, userID) != models.EnrollmentRoleInstructor {
+		return nil, errors.New("AUTHORIZATION ERROR")
+	}
 
-		db.Create(&newSubmission)
+	return &courseID, nil
+}
 
-		subResp := models.SubmissionResponse{
-			ID:                newSubmission.ID,
-			AssignmentID:      assignment.ID,
-			SubmissionUrl:     submissionInput.SubmissionUrl,
-			SubmissionDate:    newSubmission.UpdatedAt.String(),
-			SubmissionRetries: 1,
-		}
+// newAssignmentFromInput builds a draft assignment from a validated input
+func newAssignmentFromInput(input models.AssignmentInput, userID uint, courseID *uint) models.Assignment {
+	publishAt, _ := parsePublishAt(input.PublishAt)
+
+	return models.Assignment{
+		Name:               input.Name,
+		Points:             input.Points,
+		NoOfAttempts:       input.NoOfAttempts,
+		Deadline:           input.Deadline,
+		AccountID:          userID,
+		LatePolicy:         input.LatePolicy,
+		GracePeriodMinutes: input.GracePeriodMinutes,
+		LateUntil:          input.LateUntil,
+		LatePenaltyPerDay:  input.LatePenaltyPerDay,
+		Status:             models.AssignmentStatusDraft, // students can't see it until it is published
+		PublishAt:          publishAt,
+		CourseID:           courseID,
+		TeamMode:           input.TeamMode,
+		MaxTeamSize:        input.MaxTeamSize,
+		Rubric:             rubricFromInput(input.Rubric),
+	}
+}
 
-		c.JSON(http.StatusOK, subResp)
+// applyAssignmentInput copies the editable fields of a validated input onto the assignment
+func applyAssignmentInput(assignment *models.Assignment, input models.AssignmentInput, publishAt *time.Time) {
+	assignment.Name = input.Name
+	assignment.Points = input.Points
+	assignment.NoOfAttempts = input.NoOfAttempts
+	assignment.Deadline = input.Deadline
+	assignment.LatePolicy = input.LatePolicy
+	assignment.GracePeriodMinutes = input.GracePeriodMinutes
+	assignment.LateUntil = input.LateUntil
+	assignment.LatePenaltyPerDay = input.LatePenaltyPerDay
+	assignment.PublishAt = publishAt
+	assignment.TeamMode = input.TeamMode
+	assignment.MaxTeamSize = input.MaxTeamSize
+}
 
-		assName := assignment.Name
-		retry := strconv.Itoa(subResp.SubmissionRetries)
-		subTime := currentTime.String()
-		userEmail, _, _ := c.Request.BasicAuth()
-		subEmail := userEmail
-		downloadURL := subResp.SubmissionUrl
+// assignmentInputFromAssignment returns the input that would recreate the assignment
+func assignmentInputFromAssignment(assignment models.Assignment) models.AssignmentInput {
+	input := models.AssignmentInput{
+		Name:               assignment.Name,
+		Points:             assignment.Points,
+		NoOfAttempts:       assignment.NoOfAttempts,
+		Deadline:           assignment.Deadline,
+		LatePolicy:         assignment.LatePolicy,
+		GracePeriodMinutes: assignment.GracePeriodMinutes,
+		LateUntil:          assignment.LateUntil,
+		LatePenaltyPerDay:  assignment.LatePenaltyPerDay,
+		PublishAt:          formatPublishAt(assignment.PublishAt),
+		TeamMode:           assignment.TeamMode,
+		MaxTeamSize:        assignment.MaxTeamSize,
+		Rubric:             []models.RubricCriterionInput{},
+	}
+	if assignment.CourseID != nil {
+		input.CourseID = *assignment.CourseID
+	}
+	for _, criterion := range assignment.Rubric {
+		input.Rubric = append(input.Rubric, models.RubricCriterionInput{
+			Name:        criterion.Name,
+			Description: criterion.Description,
+			Weight:      criterion.Weight,
+			Levels:      criterion.Levels,
+		})
+	}
+
+	return input
+}
+
+func newAssignmentResponse(assignment models.Assignment) models.AssignmentResponse {
+	return models.AssignmentResponse{
+		ID:                 assignment.ID,
+		Name:               assignment.Name,
+		Points:             assignment.Points,
+		NoOfAttempts:       assignment.NoOfAttempts,
+		Deadline:           assignment.Deadline,
+		AssignemtCreated:   assignment.CreatedAt.String(),
+		AssignmentUpdated:  assignment.UpdatedAt.String(),
+		LatePolicy:         assignment.LatePolicy,
+		GracePeriodMinutes: assignment.GracePeriodMinutes,
+		LateUntil:          assignment.LateUntil,
+		LatePenaltyPerDay:  assignment.LatePenaltyPerDay,
+		Status:             assignment.Status,
+		PublishAt:          formatPublishAt(assignment.PublishAt),
+		CourseID:           assignment.CourseID,
+		TeamMode:           assignment.TeamMode,
+		MaxTeamSize:        assignment.MaxTeamSize,
+		Rubric:             newRubricResponse(assignment.Rubric),
+	}
+}
+
+// findOwnedAssignment loads the assignment referenced by the id parameter and
+// checks that it belongs to the given account. When it doesn't, the error
+// response is written and false is returned.
+func findOwnedAssignment(c *gin.Context, endpoint string, userID uint) (models.Assignment, bool) {
+	var assignment models.Assignment
+
+	assignmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID ASSIGNMENT ID")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
+		return assignment, false
+	}
+
+	if err := withRubric(requestDB(c)).First(&assignment, assignmentID).Error; err != nil {
+		err := errors.New("ASSIGNMENT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+		return assignment, false
+	}
+
+	// Check if the authenticated user is the owner of the assignment
+	if assignment.AccountID != userID {
+		err := errors.New("AUTHORIZATION ERROR")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The user is not the owner of this assignment")
+		abortWithProblem(c, http.StatusForbidden, "AUTHORIZATION_ERROR", "You are not authorized to manage this assignment")
+		return assignment, false
+	}
+
+	return assignment, true
+}
+
+// findVisibleAssignment loads the assignment referenced by the id parameter
+// and checks that the given account can see it. When it can't, the error
+// response is written and false is returned.
+func findVisibleAssignment(c *gin.Context, endpoint string, userID uint) (models.Assignment, bool) {
+	var assignment models.Assignment
+
+	assignmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID ASSIGNMENT ID")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
+		return assignment, false
+	}
+
+	if err := withRubric(requestDB(c)).First(&assignment, assignmentID).Error; err != nil || !canViewAssignment(requestDB(c), assignment, userID) {
+		err := errors.New("ASSIGNMENT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+		return assignment, false
+	}
+
+	return assignment, true
+}
+
+// countSubmission counts an accepted submission in the business metrics
+func countSubmission(late bool) {
+	appMetrics.Count("submissions_total")
+	if late {
+		appMetrics.Count("late_submissions_total")
+	}
+}
+
+// notifySubmission queues a submission notification for every recipient
+func notifySubmission(c *gin.Context, assignment models.Assignment, subResp models.SubmissionResponse, recipients []string, submittedAt time.Time) {
+	for _, email := range recipients {
 		var uName string
 
 		// Split the email address by "@" to separate the username and domain
-		parts := strings.Split(subEmail, "@")
+		parts := strings.Split(email, "@")
 
 		// Check if the split resulted in two parts
 		if len(parts) == 2 {
 			// The username is the first part before "@"
 			uName = parts[0]
-
-			// Print the result
-			fmt.Println(uName)
 		}
 
-		message1 := fmt.Sprintf(`{"name": "%s", "assName": "%s", "retry": "%s", "email": "%s", "time": "%s", "downloadURL": "%s"}`, uName, assName, retry, subEmail, subTime, downloadURL)
-		fmt.Println("******************************")
-		fmt.Println(message1)
-		fmt.Println("******************************")
-
-		err = publishToSNS(snsClient, topicArn, message1)
+		message, err := json.Marshal(models.SubmissionNotification{
+			Name:           uName,
+			AssignmentName: assignment.Name,
+			Retry:          strconv.Itoa(subResp.SubmissionRetries),
+			Email:          email,
+			Time:           submittedAt.String(),
+			DownloadURL:    subResp.SubmissionUrl,
+			RequestID:      requestID(c),
+		})
 		if err != nil {
-			fmt.Print("***************************PUBLISH ERRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRRR", err.Error())
-			log.Error().Err(err).Msg(err.Error())
-			//	return
-		} else {
-			fmt.Print("FMT___________________PUBLISHED SUCCESSFULLY TO SNS NewSubmission")
-			log.Info().Msg("Published successfully to sns NewSubmission")
+			requestLogger(c).Error().Err(err).Msg("SubmitAssignment Endpoint:Unable to encode the notification")
+			continue
 		}
 
-		return
+		notifications.enqueue(c.Request.Context(), assignment.ID, requestID(c), string(message))
 	}
-
 }
 
-func createSNSSession() *sns.SNS {
-	fmt.Println("************INSIDE CREATE NEW SESSION")
+func createSNSSession(region string) *sns.SNS {
+	log.Debug().Str("region", region).Msg("Creating the SNS session")
 	sess := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1"), // replace with your AWS region
+		Region: aws.String(region),
 	}))
 
 	return sns.New(sess)
 }
 
-func publishToSNS(snsClient *sns.SNS, topicArn, message string) error {
-	fmt.Println("************PUBLISH TO SNS")
+// publishToSNS publishes the message in a span of the trace of the context,
+// passing the trace context on to subscribers as message attributes.
+func publishToSNS(ctx context.Context, snsClient *sns.SNS, topicArn, message string) error {
+	log.Debug().Str("topic", topicArn).Msg("Publishing to SNS")
+	ctx, span := tracer.Start(ctx, "sns.publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		semconv.MessagingSystem("aws_sns"),
+		semconv.MessagingDestinationName(topicArn),
+	))
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	attributes := map[string]*sns.MessageAttributeValue{}
+	for key, value := range carrier {
+		attributes[key] = &sns.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+
 	params := &sns.PublishInput{
-		Message:  aws.String(message),
-		TopicArn: aws.String(topicArn),
+		Message:           aws.String(message),
+		TopicArn:          aws.String(topicArn),
+		MessageAttributes: attributes,
 	}
 
-	_, err := snsClient.Publish(params)
+	_, err := snsClient.PublishWithContext(ctx, params)
+	if err != nil {
+		redactedErr := logRedactor.redactError(err)
+		span.RecordError(redactedErr)
+		span.SetStatus(codes.Error, redactedErr.Error())
+	}
 	return err
 }
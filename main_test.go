@@ -1,12 +1,16 @@
 package main
 
 import (
+	"app/assignment/models"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHealthCheckEndpoint(t *testing.T) {
@@ -32,3 +36,124 @@ func TestHealthCheckEndpoint(t *testing.T) {
 }
 
 // Trigger a PR
+
+func TestDeleteAssignment(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	bob := testAccount(t, "bob@example.com")
+	assignment := testAssignment(t, owner, func(assignment *models.Assignment) {
+		assignment.TeamMode = models.TeamModeInstructor
+	})
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10)
+
+	team := models.Team{AssignmentID: assignment.ID, Name: "Alpha"}
+	require.NoError(t, db.Create(&team).Error)
+	require.NoError(t, db.Create(&models.TeamMember{TeamID: team.ID, AssignmentID: assignment.ID, AccountID: ada.ID}).Error)
+	submission := models.Submission{AssignmentID: uint64(assignment.ID), AccountID: ada.ID, TeamID: &team.ID, SubmissionUrl: "https://example.com/ada.zip", SubmissionRetries: 1}
+	require.NoError(t, db.Create(&submission).Error)
+	criterion := models.RubricCriterion{AssignmentID: assignment.ID, Name: "Design", Weight: 10}
+	require.NoError(t, db.Create(&criterion).Error)
+	require.NoError(t, db.Create(&models.CriterionScore{SubmissionID: submission.ID, CriterionID: criterion.ID, Points: 7}).Error)
+	extension := models.Extension{AssignmentID: assignment.ID, AccountID: ada.ID, ExtraAttempts: 1}
+	require.NoError(t, db.Create(&extension).Error)
+
+	// Rows deleted on their own before stay deleted on restore
+	revoked := models.Extension{AssignmentID: assignment.ID, AccountID: bob.ID, ExtraAttempts: 1}
+	require.NoError(t, db.Create(&revoked).Error)
+	require.NoError(t, db.Delete(&revoked).Error)
+
+	// Submissions are only deleted when asked for
+	w := testRequest(router, http.MethodDelete, path, owner.Email, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var problem models.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "ASSIGNMENT_HAS_SUBMISSIONS", problem.Code)
+	assert.Equal(t, []uint{submission.ID}, problem.Submissions)
+	var stored models.Assignment
+	require.NoError(t, db.First(&stored, assignment.ID).Error)
+
+	w = testRequest(router, http.MethodDelete, path+"?force=true", owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var deleteResp models.DeleteAssignmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deleteResp))
+	assert.Equal(t, []uint{submission.ID}, deleteResp.Submissions)
+	assert.Equal(t, models.CascadedRows{RubricScores: 1, Extensions: 1, Teams: 1, TeamMembers: 1}, deleteResp.CascadedRows)
+	assert.Contains(t, w.Body.String(), `"team_members":1`)
+
+	counts := func() []int64 {
+		t.Helper()
+		counts := []int64{}
+		for _, model := range []interface{}{&models.Submission{}, &models.CriterionScore{}, &models.Extension{}, &models.Team{}, &models.TeamMember{}} {
+			var count int64
+			require.NoError(t, db.Model(model).Count(&count).Error)
+			counts = append(counts, count)
+		}
+		return counts
+	}
+	assert.Equal(t, []int64{0, 0, 0, 0, 0}, counts())
+
+	var deletedSubmission models.Submission
+	require.NoError(t, db.Unscoped().First(&deletedSubmission, submission.ID).Error)
+
+	w = testRequest(router, http.MethodPost, path+"/restore", owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []int64{1, 1, 1, 1, 1}, counts())
+
+	// Restored submissions keep the time they were last submitted
+	var restoredSubmission models.Submission
+	require.NoError(t, db.First(&restoredSubmission, submission.ID).Error)
+	assert.Equal(t, deletedSubmission.UpdatedAt, restoredSubmission.UpdatedAt)
+	var restoredExtension models.Extension
+	require.NoError(t, db.Where("assignment_id = ?", assignment.ID).First(&restoredExtension).Error)
+	assert.Equal(t, extension.ID, restoredExtension.ID)
+
+	// Without submissions, nothing is reported
+	require.NoError(t, db.Unscoped().Where("assignment_id = ?", assignment.ID).Delete(&models.Submission{}).Error)
+	w = testRequest(router, http.MethodDelete, path, owner.Email, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAssignmentValidation(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	assignment := testAssignment(t, owner, nil)
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10)
+
+	problem := func(w *httptest.ResponseRecorder) models.Problem {
+		t.Helper()
+		require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		var problem models.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		return problem
+	}
+
+	// A deadline that has passed is listed with the other invalid fields
+	input := models.AssignmentInput{Points: 10, NoOfAttempts: 3, Deadline: "2020-01-10T23:59:00.000Z"}
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		target := "/v1/assignments"
+		if method == http.MethodPut {
+			target = path
+		}
+		assert.Equal(t, []models.FieldError{
+			{Field: "name", Reason: "is required"},
+			{Field: "deadline", Reason: "should be in the future"},
+		}, problem(testRequest(router, method, target, owner.Email, input)).InvalidFields, method)
+	}
+
+	// Both report the other rules the same way
+	input = assignmentInputFromAssignment(assignment)
+	input.CourseID = 1
+	input.LatePolicy = models.LatePolicyLateUntil
+	created := problem(testRequest(router, http.MethodPost, "/v1/assignments", owner.Email, input))
+	updated := problem(testRequest(router, http.MethodPut, path, owner.Email, input))
+	assert.Equal(t, "INVALID_ASSIGNMENT", updated.Code)
+	assert.Equal(t, created.Detail, updated.Detail)
+	assert.Equal(t, created.InvalidFields, updated.InvalidFields)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	statsd "github.com/etsy/statsd/examples/go"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// metricsBackend receives the metrics of the webapp. Metrics are named the
+// Prometheus way and labels are given as name, value pairs. A metric has to
+// keep the same label names on every call.
+type metricsBackend interface {
+	// Count adds one to a counter
+	Count(name string, labels ...string)
+	// Observe records a duration in a histogram
+	Observe(name string, duration time.Duration, labels ...string)
+}
+
+// Metrics of the webapp, set up by main from metrics.backends
+var appMetrics metricsBackend = multiMetrics{}
+
+// Handler of /metrics, nil unless the Prometheus backend is enabled
+var metricsHandler http.Handler
+
+// Descriptions of the metrics, for the backends documenting them
+var metricHelp = map[string]string{
+	"http_requests_total":           "HTTP requests by method, route and status",
+	"http_request_duration_seconds": "Time to answer HTTP requests by method, route and status",
+	"db_query_duration_seconds":     "Time of database statements by operation and table",
+	"submissions_total":             "Accepted assignment submissions",
+	"late_submissions_total":        "Accepted submissions that were late",
+	"notifications_published_total": "Notifications published to SNS",
+	"notification_failures_total":   "Notifications SNS didn't accept",
+	"notifications_dropped_total":   "Notifications enqueued after the shutdown started",
+}
+
+// Histogram buckets, in seconds, of the metrics not using the default ones
+var metricBuckets = map[string][]float64{
+	"db_query_duration_seconds": prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms to 4s
+}
+
+// metricsConfig holds the settings of the metrics
+type metricsConfig struct {
+	Backends   []string `yaml:"backends"`    // statsd, prometheus or none
+	StatsdAddr string   `yaml:"statsd_addr"` // where StatsD metrics are sent
+}
+
+func (c metricsConfig) validate() error {
+	var errs []error
+	for _, name := range c.Backends {
+		switch name {
+		case "statsd":
+			if _, _, err := statsdHostPort(c.StatsdAddr); err != nil {
+				errs = append(errs, fmt.Errorf("metrics.statsd_addr should be a host:port, got %q", c.StatsdAddr))
+			}
+		case "prometheus", "none":
+		default:
+			errs = append(errs, fmt.Errorf("metrics.backends should list statsd, prometheus or none, got %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newMetrics sets up the backends of the config, along with the handler
+// of /metrics when Prometheus is one of them.
+func newMetrics(config metricsConfig) (metricsBackend, http.Handler, error) {
+	backends := multiMetrics{}
+	var handler http.Handler
+	for _, name := range config.Backends {
+		switch name {
+		case "statsd":
+			host, port, err := statsdHostPort(config.StatsdAddr)
+			if err != nil {
+				return nil, nil, err
+			}
+			backends = append(backends, statsdMetrics{client: statsd.New(host, port)})
+		case "prometheus":
+			prometheusBackend := newPrometheusMetrics()
+			backends = append(backends, prometheusBackend)
+			handler = prometheusBackend.handler()
+		}
+	}
+
+	return backends, handler, nil
+}
+
+func statsdHostPort(addr string) (string, int, error) {
+	host, portValue, ok := strings.Cut(addr, ":")
+	port, err := strconv.Atoi(portValue)
+	if !ok || err != nil {
+		return "", 0, fmt.Errorf("invalid StatsD address %q", addr)
+	}
+	return host, port, nil
+}
+
+// multiMetrics sends the metrics to every backend
+type multiMetrics []metricsBackend
+
+func (m multiMetrics) Count(name string, labels ...string) {
+	for _, backend := range m {
+		backend.Count(name, labels...)
+	}
+}
+
+func (m multiMetrics) Observe(name string, duration time.Duration, labels ...string) {
+	for _, backend := range m {
+		backend.Observe(name, duration, labels...)
+	}
+}
+
+// statsdMetrics sends the metrics over UDP to the StatsD listener of the
+// CloudWatch agent, with labels as DogStatsD tags.
+type statsdMetrics struct {
+	client *statsd.StatsdClient
+}
+
+func (m statsdMetrics) Count(name string, labels ...string) {
+	m.client.Send(map[string]string{statsdName(name): "1|c" + statsdTags(labels)}, 1)
+}
+
+func (m statsdMetrics) Observe(name string, duration time.Duration, labels ...string) {
+	milliseconds := strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 3, 64)
+	m.client.Send(map[string]string{statsdName(name): milliseconds + "|ms" + statsdTags(labels)}, 1)
+}
+
+// statsdName drops the unit suffixes StatsD types already imply
+func statsdName(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, "_total"), "_seconds")
+}
+
+func statsdTags(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	tags := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		tags = append(tags, labels[i]+":"+labels[i+1])
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// prometheusMetrics keeps the metrics in a registry scraped on /metrics.
+// Collectors are created on first use of each metric.
+type prometheusMetrics struct {
+	registry *prometheus.Registry
+
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	return &prometheusMetrics{
+		registry:   registry,
+		counters:   map[string]*prometheus.CounterVec{},
+		histograms: map[string]*prometheus.HistogramVec{},
+	}
+}
+
+func (m *prometheusMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *prometheusMetrics) Count(name string, labels ...string) {
+	names, values := splitLabels(labels)
+
+	m.mu.Lock()
+	counter, ok := m.counters[name]
+	if !ok {
+		counter = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: metricDescription(name)}, names)
+		m.counters[name] = counter
+		m.register(name, counter)
+	}
+	m.mu.Unlock()
+
+	if c, err := counter.GetMetricWithLabelValues(values...); err == nil {
+		c.Inc()
+	} else {
+		log.Error().Err(err).Str("metric", name).Msg("Unable to count the metric")
+	}
+}
+
+func (m *prometheusMetrics) Observe(name string, duration time.Duration, labels ...string) {
+	names, values := splitLabels(labels)
+
+	m.mu.Lock()
+	histogram, ok := m.histograms[name]
+	if !ok {
+		buckets, ok := metricBuckets[name]
+		if !ok {
+			buckets = prometheus.DefBuckets
+		}
+		histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: metricDescription(name), Buckets: buckets}, names)
+		m.histograms[name] = histogram
+		m.register(name, histogram)
+	}
+	m.mu.Unlock()
+
+	if h, err := histogram.GetMetricWithLabelValues(values...); err == nil {
+		h.Observe(duration.Seconds())
+	} else {
+		log.Error().Err(err).Str("metric", name).Msg("Unable to observe the metric")
+	}
+}
+
+func (m *prometheusMetrics) register(name string, collector prometheus.Collector) {
+	if err := m.registry.Register(collector); err != nil {
+		log.Error().Err(err).Str("metric", name).Msg("Unable to register the metric")
+	}
+}
+
+// splitLabels separates the names and values of name, value pairs
+func splitLabels(labels []string) ([]string, []string) {
+	names, values := []string{}, []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		names = append(names, labels[i])
+		values = append(values, labels[i+1])
+	}
+	return names, values
+}
+
+func metricDescription(name string) string {
+	if description, ok := metricHelp[name]; ok {
+		return description
+	}
+	return strings.ReplaceAll(name, "_", " ")
+}
+
+// metricsMiddleware counts and times every request by method, route
+// template and status. Requests matching no route share one label so
+// scanners can't blow up the number of series.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := []string{"method", c.Request.Method, "route", openAPIPath(route), "status", strconv.Itoa(c.Writer.Status())}
+
+		appMetrics.Count("http_requests_total", labels...)
+		appMetrics.Observe("http_request_duration_seconds", time.Since(start), labels...)
+	}
+}
+
+// getMetrics exposes the Prometheus metrics
+func getMetrics(c *gin.Context) {
+	if metricsHandler == nil {
+		abortWithProblem(c, http.StatusNotFound, "METRICS_DISABLED", "The Prometheus metrics backend isn't enabled")
+		return
+	}
+
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
+
+// gormMetrics is a gorm plugin timing every statement by operation and table
+type gormMetrics struct{}
+
+const gormMetricsStartKey = "metrics:start"
+
+func (gormMetrics) Name() string {
+	return "metrics"
+}
+
+func (gormMetrics) Initialize(db *gorm.DB) error {
+	start := func(tx *gorm.DB) {
+		tx.InstanceSet(gormMetricsStartKey, time.Now())
+	}
+	observe := func(operation string) func(tx *gorm.DB) {
+		return func(tx *gorm.DB) {
+			value, ok := tx.InstanceGet(gormMetricsStartKey)
+			if !ok {
+				return
+			}
+			table := tx.Statement.Table
+			if table == "" {
+				table = "unknown"
+			}
+			appMetrics.Observe("db_query_duration_seconds", time.Since(value.(time.Time)), "operation", operation, "table", table)
+		}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("metrics:before_create", start),
+		callbacks.Create().After("gorm:create").Register("metrics:after_create", observe("create")),
+		callbacks.Query().Before("gorm:query").Register("metrics:before_query", start),
+		callbacks.Query().After("gorm:query").Register("metrics:after_query", observe("query")),
+		callbacks.Update().Before("gorm:update").Register("metrics:before_update", start),
+		callbacks.Update().After("gorm:update").Register("metrics:after_update", observe("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", start),
+		callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")),
+		callbacks.Row().Before("gorm:row").Register("metrics:before_row", start),
+		callbacks.Row().After("gorm:row").Register("metrics:after_row", observe("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", start),
+		callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw")),
+	)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+
+	backend := newPrometheusMetrics()
+	previousMetrics, previousHandler := appMetrics, metricsHandler
+	appMetrics, metricsHandler = backend, backend.handler()
+	defer func() { appMetrics, metricsHandler = previousMetrics, previousHandler }()
+
+	router := gin.New()
+	router.Use(metricsMiddleware(), problemMiddleware())
+	router.NoRoute(notFound)
+	router.GET("/metrics", getMetrics)
+	router.GET("/v1/assignments/:id", func(c *gin.Context) {
+		countSubmission(true)
+		c.Status(http.StatusNoContent)
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	get("/v1/assignments/1")
+	get("/v1/assignments/2")
+	get("/wp-login.php")
+	appMetrics.Observe("db_query_duration_seconds", 3*time.Millisecond, "operation", "query", "table", "assignments")
+
+	// Requests are labeled with their route template, not their path
+	w := get("/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/v1/assignments/{id}",status="204"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/v1/assignments/{id}",status="204"} 2`)
+	assert.Contains(t, body, `db_query_duration_seconds_bucket{operation="query",table="assignments",le="0.004"} 1`)
+	assert.Contains(t, body, "submissions_total 2")
+	assert.Contains(t, body, "late_submissions_total 2")
+	assert.Contains(t, body, "# HELP late_submissions_total Accepted submissions that were late")
+
+	// Without the Prometheus backend there is nothing to scrape
+	metricsHandler = nil
+	assert.Equal(t, http.StatusNotFound, get("/metrics").Code)
+}
+
+func TestStatsdFormat(t *testing.T) {
+
+	assert.Equal(t, "http_request_duration", statsdName("http_request_duration_seconds"))
+	assert.Equal(t, "submissions", statsdName("submissions_total"))
+	assert.Equal(t, "healthz_counter", statsdName("healthz_counter"))
+
+	assert.Equal(t, "", statsdTags(nil))
+	assert.Equal(t, "|#method:GET,route:/v1/assignments/{id}", statsdTags([]string{"method", "GET", "route", "/v1/assignments/{id}"}))
+}
@@ -1,6 +1,37 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lifecycle statuses of an assignment
+const (
+	AssignmentStatusDraft     = "draft"
+	AssignmentStatusPublished = "published"
+	AssignmentStatusClosed    = "closed"
+	AssignmentStatusArchived  = "archived"
+)
+
+// Late submission policies of an assignment
+const (
+	LatePolicyHardCutoff  = "hard_cutoff"  // nothing is accepted after the deadline
+	LatePolicyGracePeriod = "grace_period" // accepted without penalty until deadline + grace period
+	LatePolicyLateUntil   = "late_until"   // accepted with a daily penalty until the late-until date
+)
+
+// Roles of an account enrolled in a course
+const (
+	EnrollmentRoleInstructor = "instructor"
+	EnrollmentRoleStudent    = "student"
+)
+
+// Team modes of a group assignment
+const (
+	TeamModeInstructor = "instructor"  // teams are formed by the owner of the assignment
+	TeamModeSelfSignup = "self_signup" // students create and join teams themselves
+)
 
 type Account struct {
 	gorm.Model
@@ -19,44 +50,495 @@ type Assignment struct {
 	Deadline     string  `json:"deadline"`
 	AccountID    uint    // Foreign key to Account table
 	Account      Account `gorm:"foreignKey:AccountID"`
+
+	LatePolicy         string  `gorm:"size:20;default:hard_cutoff" json:"late_policy"`
+	GracePeriodMinutes int     `json:"grace_period_minutes"`
+	LateUntil          string  `json:"late_until"`
+	LatePenaltyPerDay  float64 `json:"late_penalty_per_day"` // percentage of the score deducted per started day
+
+	Status    string     `gorm:"size:20;default:published;index" json:"status"`
+	PublishAt *time.Time `json:"publish_at"` // drafts are published automatically at this time
+
+	CourseID *uint  `gorm:"index" json:"course_id"` // nil for assignments created before courses existed
+	Course   Course `gorm:"foreignKey:CourseID" json:"-"`
+
+	TeamMode    string `gorm:"size:20" json:"team_mode"` // empty for individual assignments
+	MaxTeamSize int    `json:"max_team_size"`
+
+	Rubric []RubricCriterion `gorm:"foreignKey:AssignmentID" json:"rubric"`
 }
 
 type AssignmentInput struct {
-	Name         string `json:"name"`
-	Points       int    `json:"points"`
-	NoOfAttempts int    `json:"noofattempts"`
-	Deadline     string `json:"deadline"`
+	Name         string `json:"name" binding:"required,max=255"`
+	Points       int    `json:"points" binding:"min=1,max=100"`
+	NoOfAttempts int    `json:"noofattempts" binding:"min=1,max=100"`
+	Deadline     string `json:"deadline" binding:"required,deadline"` // has to be in the future when created or changed
 	//AccountID    uint   // Foreign key to Account table
+
+	LatePolicy         string  `json:"late_policy" binding:"omitempty,oneof=hard_cutoff grace_period late_until"`
+	GracePeriodMinutes int     `json:"grace_period_minutes" binding:"min=0"`
+	LateUntil          string  `json:"late_until" binding:"omitempty,deadline"`
+	LatePenaltyPerDay  float64 `json:"late_penalty_per_day" binding:"min=0,max=100"`
+
+	PublishAt string `json:"publish_at" binding:"omitempty,deadline"`
+	CourseID  uint   `json:"course_id"` // required to create an assignment, ignored on update
+
+	TeamMode    string `json:"team_mode" binding:"omitempty,oneof=instructor self_signup"`
+	MaxTeamSize int    `json:"max_team_size" binding:"min=0,max=100"`
+
+	Rubric []RubricCriterionInput `json:"rubric" binding:"dive"` // nil keeps the rubric of the assignment on update
 }
 
+// AssignmentResponse is the assignment representation of the v1 API. The
+// capitalized keys, typo included, are kept for existing clients.
 type AssignmentResponse struct {
-	ID                uint
+	ID                uint   `json:"ID"`
 	Name              string `json:"name"`
 	Points            int    `json:"points"`
 	NoOfAttempts      int    `json:"noofattempts"`
 	Deadline          string `json:"deadline"`
-	AssignemtCreated  string
-	AssignmentUpdated string
+	AssignemtCreated  string `json:"AssignemtCreated"`
+	AssignmentUpdated string `json:"AssignmentUpdated"`
+
+	LatePolicy         string  `json:"late_policy"`
+	GracePeriodMinutes int     `json:"grace_period_minutes"`
+	LateUntil          string  `json:"late_until"`
+	LatePenaltyPerDay  float64 `json:"late_penalty_per_day"`
+
+	Status    string `json:"status"`
+	PublishAt string `json:"publish_at"`
+	CourseID  *uint  `json:"course_id"`
+
+	TeamMode    string `json:"team_mode"`
+	MaxTeamSize int    `json:"max_team_size"`
+
+	Rubric []RubricCriterionResponse `json:"rubric"`
+}
+
+// AssignmentResponseV2 is the assignment representation of the v2 API, with
+// snake_case keys and RFC 3339 timestamps.
+type AssignmentResponseV2 struct {
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	Points       int    `json:"points"`
+	NoOfAttempts int    `json:"no_of_attempts"`
+	Deadline     string `json:"deadline"`
+
+	LatePolicy         string  `json:"late_policy"`
+	GracePeriodMinutes int     `json:"grace_period_minutes"`
+	LateUntil          string  `json:"late_until,omitempty"`
+	LatePenaltyPerDay  float64 `json:"late_penalty_per_day"`
+
+	Status    string  `json:"status"`
+	PublishAt *string `json:"publish_at"`
+	CourseID  *uint   `json:"course_id"`
+
+	TeamMode    string `json:"team_mode"`
+	MaxTeamSize int    `json:"max_team_size"`
+
+	Rubric []RubricCriterionResponse `json:"rubric"`
+
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 type Submission struct {
 	gorm.Model
-	AssignmentID      uint64     // Foreign Key to Assignment Table
+	AssignmentID      uint64     `gorm:"index;uniqueIndex:idx_submission_team"` // Foreign Key to Assignment Table
 	Assignment        Assignment `gorm:"foreignKey:AssignmentID"`
 	AccountID         uint       // Foreign key to Account table
 	Account           Account    `gorm:"foreignKey:AccountID"`
 	SubmissionUrl     string     `json:"submission_url"`
 	SubmissionRetries int
+	TeamID            *uint    `gorm:"index;uniqueIndex:idx_submission_team" json:"team_id"` // shared submission of a team assignment, one per team
+	Score             *float64 `json:"score"`                                                // nil until the submission is graded
+	IsLate            bool     `json:"is_late"`
+	LatePenalty       float64  `json:"late_penalty"` // percentage deducted from the score
 }
 
 type SubmissionInput struct {
-	SubmissionUrl string `json:"submission_url"`
+	SubmissionUrl string `json:"submission_url" binding:"required,url,max=2048"`
 }
 
 type SubmissionResponse struct {
 	ID                uint
-	AssignmentID      uint   `json:"assignment_id"`
-	SubmissionUrl     string `json:"submission_url"`
-	SubmissionDate    string `json:"submission_date"`
-	SubmissionRetries int    `json:"submission_retries"`
+	AssignmentID      uint    `json:"assignment_id"`
+	SubmissionUrl     string  `json:"submission_url"`
+	SubmissionDate    string  `json:"submission_date"`
+	SubmissionRetries int     `json:"submission_retries"`
+	IsLate            bool    `json:"is_late"`
+	LatePenalty       float64 `json:"late_penalty"`
+}
+
+// HealthReport details the checks behind a liveness or readiness answer
+type HealthReport struct {
+	Status string        `json:"status"` // ok or unavailable
+	Checks []HealthCheck `json:"checks"`
+}
+
+type HealthCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"` // only shown on the admin listener
+	Duration string `json:"duration"`
+}
+
+// SubmissionNotification is the message published to SNS for each recipient
+// of a submission
+type SubmissionNotification struct {
+	Name           string `json:"name"`
+	AssignmentName string `json:"assName"`
+	Retry          string `json:"retry"`
+	Email          string `json:"email"`
+	Time           string `json:"time"`
+	DownloadURL    string `json:"downloadURL"`
+	RequestID      string `json:"requestId"` // of the submission, to correlate the logs
+}
+
+type GradebookEntry struct {
+	AccountID        uint     `json:"account_id"`
+	Firstname        string   `json:"firstname"`
+	LastName         string   `json:"lastname"`
+	Email            string   `json:"email"`
+	AssignmentID     uint     `json:"assignment_id"`
+	AssignmentName   string   `json:"assignment_name"`
+	Attempts         int      `json:"attempts"`
+	LatestSubmission string   `json:"latest_submission"`
+	Late             bool     `json:"late"`
+	LatePenalty      float64  `json:"late_penalty"`
+	Score            *float64 `json:"score"`
+
+	RubricScores []RubricScore `json:"rubric_scores"`
+}
+
+// Extension is unique per assignment and account, a revoked extension is
+// revived by the next grant
+type Extension struct {
+	gorm.Model
+	AssignmentID  uint       `gorm:"uniqueIndex:idx_extension_account" json:"assignment_id"` // Foreign Key to Assignment Table
+	Assignment    Assignment `gorm:"foreignKey:AssignmentID" json:"-"`
+	AccountID     uint       `gorm:"uniqueIndex:idx_extension_account" json:"account_id"` // Account the extension is granted to
+	Account       Account    `gorm:"foreignKey:AccountID" json:"-"`
+	Deadline      string     `json:"deadline"` // empty keeps the deadline of the assignment
+	ExtraAttempts int        `json:"extra_attempts"`
+	GrantedByID   uint       `json:"granted_by"`
+}
+
+type ExtensionInput struct {
+	Email         string `json:"email"`
+	Deadline      string `json:"deadline"`
+	ExtraAttempts int    `json:"extra_attempts"`
+}
+
+type ExtensionResponse struct {
+	ID            uint   `json:"id"`
+	AssignmentID  uint   `json:"assignment_id"`
+	AccountID     uint   `json:"account_id"`
+	Email         string `json:"email"`
+	Deadline      string `json:"deadline"`
+	ExtraAttempts int    `json:"extra_attempts"`
+	GrantedBy     uint   `json:"granted_by"`
+	Granted       string `json:"granted"`
+}
+
+type AuditEvent struct {
+	gorm.Model
+	AccountID  uint   // Account that performed the action
+	Action     string `gorm:"size:50;not null"`
+	Resource   string `gorm:"size:50;not null"`
+	ResourceID uint
+	Detail     string `gorm:"type:text"` // JSON document describing the change
+}
+
+type Course struct {
+	gorm.Model
+	Name      string  `gorm:"size:225;not null" json:"name"`
+	Code      string  `gorm:"size:50;not null;unique" json:"code"`
+	AccountID uint    // Account that created the course
+	Account   Account `gorm:"foreignKey:AccountID" json:"-"`
+}
+
+type CourseInput struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+type CourseResponse struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Code    string `json:"code"`
+	Role    string `json:"role"` // role of the caller in the course
+	Created string `json:"created"`
+}
+
+// Enrollment is unique per course and account, an unenrolled account is
+// enrolled again by reviving its enrollment
+type Enrollment struct {
+	gorm.Model
+	CourseID  uint    `gorm:"uniqueIndex:idx_enrollment_account" json:"course_id"`
+	Course    Course  `gorm:"foreignKey:CourseID" json:"-"`
+	AccountID uint    `gorm:"index;uniqueIndex:idx_enrollment_account" json:"account_id"`
+	Account   Account `gorm:"foreignKey:AccountID" json:"-"`
+	Role      string  `gorm:"size:20;not null" json:"role"`
+}
+
+type EnrollmentInput struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type EnrollmentResponse struct {
+	ID        uint   `json:"id"`
+	CourseID  uint   `json:"course_id"`
+	AccountID uint   `json:"account_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+}
+
+type EnrollmentImportResponse struct {
+	Enrolled int      `json:"enrolled"`
+	Updated  int      `json:"updated"`
+	Errors   []string `json:"errors"`
+}
+
+type Team struct {
+	gorm.Model
+	AssignmentID uint         `gorm:"index" json:"assignment_id"`
+	Name         string       `gorm:"size:225;not null" json:"name"`
+	Members      []TeamMember // one to many relationship
+}
+
+// MemberEmails returns the email of every member, the Members and their
+// Account must have been preloaded.
+func (t Team) MemberEmails() []string {
+	emails := []string{}
+	for _, member := range t.Members {
+		emails = append(emails, member.Account.Email)
+	}
+	return emails
+}
+
+// TeamMember is removed for good when the account leaves the team, the audit
+// log keeping track of it
+type TeamMember struct {
+	gorm.Model
+	TeamID       uint    `gorm:"index"`
+	AssignmentID uint    `gorm:"uniqueIndex:idx_team_member_account"` // an account is in at most one team per assignment
+	AccountID    uint    `gorm:"index;uniqueIndex:idx_team_member_account"`
+	Account      Account `gorm:"foreignKey:AccountID"`
+}
+
+type TeamInput struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"` // emails of the members, ignored on self signup
+}
+
+type TeamResponse struct {
+	ID           uint     `json:"id"`
+	AssignmentID uint     `json:"assignment_id"`
+	Name         string   `json:"name"`
+	Members      []string `json:"members"`
+}
+
+type RubricCriterion struct {
+	gorm.Model
+	AssignmentID uint          `gorm:"index"`
+	Name         string        `gorm:"size:225;not null"`
+	Description  string        `gorm:"type:text"`
+	Weight       int           // points of the criterion, the weights of a rubric add up to the assignment points
+	Levels       []RubricLevel `gorm:"serializer:json;type:text"`
+}
+
+// RubricLevel describes what earns a given number of points on a criterion
+type RubricLevel struct {
+	Label       string `json:"label" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=1000"`
+	Points      int    `json:"points" binding:"min=0"`
+}
+
+type RubricCriterionInput struct {
+	Name        string        `json:"name" binding:"required,max=255"`
+	Description string        `json:"description" binding:"max=1000"`
+	Weight      int           `json:"weight" binding:"min=1"`
+	Levels      []RubricLevel `json:"levels" binding:"dive"`
+}
+
+type RubricCriterionResponse struct {
+	ID          uint          `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Weight      int           `json:"weight"`
+	Levels      []RubricLevel `json:"levels"`
+}
+
+type CriterionScore struct {
+	gorm.Model
+	SubmissionID uint            `gorm:"index"`
+	CriterionID  uint            `gorm:"index"`
+	Criterion    RubricCriterion `gorm:"foreignKey:CriterionID"`
+	Points       float64
+	Comment      string `gorm:"type:text"`
+	GraderID     uint
+}
+
+type CriterionScoreInput struct {
+	CriterionID uint    `json:"criterion_id"`
+	Points      float64 `json:"points"`
+	Comment     string  `json:"comment"`
+}
+
+type GradeInput struct {
+	Score  *float64              `json:"score"`  // for assignments without a rubric
+	Scores []CriterionScoreInput `json:"scores"` // for assignments with a rubric
+}
+
+type GradeResponse struct {
+	SubmissionID uint                  `json:"submission_id"`
+	Score        float64               `json:"score"`
+	LatePenalty  float64               `json:"late_penalty"`
+	FinalScore   float64               `json:"final_score"` // score after the late penalty
+	Scores       []CriterionScoreInput `json:"scores"`
+}
+
+// RubricScore is the score given on one criterion, as shown in the gradebook
+type RubricScore struct {
+	Criterion string  `json:"criterion"`
+	Points    float64 `json:"points"`
+}
+
+type AssignmentTemplate struct {
+	gorm.Model
+	AccountID          uint // Owner of the template
+	Name               string
+	Points             int
+	NoOfAttempts       int
+	LatePolicy         string `gorm:"size:20"`
+	GracePeriodMinutes int
+	LateWindowMinutes  int // late-until date as an offset from the deadline
+	LatePenaltyPerDay  float64
+	TeamMode           string `gorm:"size:20"`
+	MaxTeamSize        int
+	Rubric             []RubricCriterionInput `gorm:"serializer:json;type:text"`
+}
+
+type TemplateInput struct {
+	AssignmentID       uint                   `json:"assignment_id"` // copy the settings of an existing assignment
+	Name               string                 `json:"name"`
+	Points             int                    `json:"points"`
+	NoOfAttempts       int                    `json:"noofattempts"`
+	LatePolicy         string                 `json:"late_policy"`
+	GracePeriodMinutes int                    `json:"grace_period_minutes"`
+	LateWindowMinutes  int                    `json:"late_window_minutes"`
+	LatePenaltyPerDay  float64                `json:"late_penalty_per_day"`
+	TeamMode           string                 `json:"team_mode"`
+	MaxTeamSize        int                    `json:"max_team_size"`
+	Rubric             []RubricCriterionInput `json:"rubric"`
+}
+
+type TemplateResponse struct {
+	ID                 uint                   `json:"id"`
+	Name               string                 `json:"name"`
+	Points             int                    `json:"points"`
+	NoOfAttempts       int                    `json:"noofattempts"`
+	LatePolicy         string                 `json:"late_policy"`
+	GracePeriodMinutes int                    `json:"grace_period_minutes"`
+	LateWindowMinutes  int                    `json:"late_window_minutes"`
+	LatePenaltyPerDay  float64                `json:"late_penalty_per_day"`
+	TeamMode           string                 `json:"team_mode"`
+	MaxTeamSize        int                    `json:"max_team_size"`
+	Rubric             []RubricCriterionInput `json:"rubric"`
+	Created            string                 `json:"created"`
+}
+
+// TemplateInstance describes one assignment to create from a template
+type TemplateInstance struct {
+	Name      string `json:"name"` // defaults to the name of the template
+	Deadline  string `json:"deadline"`
+	PublishAt string `json:"publish_at"`
+	CourseID  uint   `json:"course_id"`
+}
+
+type InstantiateInput struct {
+	Assignments []TemplateInstance `json:"assignments"`
+}
+
+type CloneInput struct {
+	Name           string `json:"name"`            // defaults to the name of the cloned assignment
+	DeadlineOffset string `json:"deadline_offset"` // duration added to every date, e.g. "168h"
+	Deadline       string `json:"deadline"`        // target deadline, other dates move by the same amount
+	CourseID       uint   `json:"course_id"`       // defaults to the course of the cloned assignment
+}
+
+// AssignmentImportResponse reports the outcome of a bulk assignment import.
+// Rows are numbered from 1 in the order they appear in the document.
+type AssignmentImportResponse struct {
+	DryRun      bool        `json:"dry_run"`
+	Valid       int         `json:"valid"`
+	Errors      []string    `json:"errors"`
+	Assignments interface{} `json:"assignments"` // in the representation of the API version
+}
+
+// AssignmentRevision captures an assignment after each change along with the
+// fields that changed since the previous revision.
+type AssignmentRevision struct {
+	gorm.Model
+	AssignmentID uint            `gorm:"index;uniqueIndex:idx_revision_number"`
+	Revision     int             `gorm:"uniqueIndex:idx_revision_number"` // numbered from 1 for every assignment
+	AccountID    uint            // who made the change, 0 for the publish scheduler
+	Action       string          `gorm:"size:20"` // create, update, delete, restore, revert or the new status
+	Status       string          `gorm:"size:20"`
+	Snapshot     AssignmentInput `gorm:"serializer:json;type:text"`
+	Changes      []FieldChange   `gorm:"serializer:json;type:text"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type AssignmentRevisionResponse struct {
+	Revision  int             `json:"revision"`
+	AccountID uint            `json:"account_id"`
+	Action    string          `json:"action"`
+	Status    string          `json:"status"`
+	Changes   []FieldChange   `json:"changes"`
+	Snapshot  AssignmentInput `json:"snapshot"`
+	Created   string          `json:"created"`
+}
+
+// DeleteAssignmentResponse lists what a forced deletion removed along with the assignment
+type DeleteAssignmentResponse struct {
+	AssignmentID uint   `json:"assignment_id"`
+	Submissions  []uint `json:"submissions"`
+	CascadedRows
+}
+
+// CascadedRows counts the rows of an assignment, besides its submissions,
+// deleted or restored along with it
+type CascadedRows struct {
+	RubricScores int64 `json:"rubric_scores"`
+	Extensions   int64 `json:"extensions"`
+	Teams        int64 `json:"teams"`
+	TeamMembers  int64 `json:"team_members"`
+}
+
+// Problem is an RFC 7807 problem details document describing a failed request
+type Problem struct {
+	Type      string   `json:"type"`
+	Title     string   `json:"title"`
+	Status    int      `json:"status"`
+	Detail    string   `json:"detail,omitempty"`
+	Code      string   `json:"code"` // stable machine-readable error code
+	RequestID string   `json:"request_id,omitempty"`
+	Errors    []string `json:"errors,omitempty"` // individual errors of a bulk operation
+
+	InvalidFields []FieldError `json:"invalid_fields,omitempty"`
+	Submissions   []uint       `json:"submissions,omitempty"` // submissions keeping an assignment from being deleted
+}
+
+// FieldError describes why a field of a request body is invalid
+type FieldError struct {
+	Field  string `json:"field"` // JSON path of the field, e.g. rubric[0].name
+	Reason string `json:"reason"`
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// notification is a message waiting to be published
+type notification struct {
+	assignmentID uint
+	requestID    string            // of the request that caused it
+	spanContext  trace.SpanContext // of the request, for the publish span to join its trace
+	message      string
+}
+
+// notifier publishes notifications in the background so requests don't wait
+// on SNS, and lets the queue be drained on shutdown.
+type notifier struct {
+	publish func(ctx context.Context, message string) error
+	timeout time.Duration // of each publish
+	queue   chan notification
+	done    chan struct{}
+
+	// Once draining starts, notifications are dropped instead of queued.
+	// Enqueuing holds mu for reading so the queue isn't closed under it,
+	// and stopping unblocks those waiting for room in a full queue.
+	mu        sync.RWMutex
+	closed    bool
+	stopping  chan struct{}
+	closeOnce sync.Once
+}
+
+// Notifier of the submissions, set up by main
+var notifications *notifier
+
+func newNotifier(publish func(ctx context.Context, message string) error, timeout time.Duration, size int) *notifier {
+	return &notifier{
+		publish:  publish,
+		timeout:  timeout,
+		queue:    make(chan notification, size),
+		done:     make(chan struct{}),
+		stopping: make(chan struct{}),
+	}
+}
+
+// run publishes the queued notifications until the queue is closed and empty
+func (n *notifier) run() {
+	defer close(n.done)
+
+	for notification := range n.queue {
+		ctx, cancel := context.WithTimeout(trace.ContextWithRemoteSpanContext(context.Background(), notification.spanContext), n.timeout)
+		err := n.publish(ctx, notification.message)
+		cancel()
+		if err != nil {
+			appMetrics.Count("notification_failures_total")
+			log.Error().Err(err).Str("request_id", notification.requestID).Uint("assignment", notification.assignmentID).Msg("Unable to publish to sns")
+			continue
+		}
+		appMetrics.Count("notifications_published_total")
+		log.Info().Str("request_id", notification.requestID).Uint("assignment", notification.assignmentID).Msg("Published successfully to sns")
+	}
+}
+
+// enqueue queues a notification on behalf of the request of the context,
+// waiting for room when the queue is full. Notifications enqueued once
+// draining started are dropped.
+func (n *notifier) enqueue(ctx context.Context, assignmentID uint, requestID string, message string) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if !n.closed {
+		select {
+		case n.queue <- notification{assignmentID: assignmentID, requestID: requestID, spanContext: trace.SpanContextFromContext(ctx), message: message}:
+			return
+		case <-n.stopping:
+		}
+	}
+
+	appMetrics.Count("notifications_dropped_total")
+	log.Error().Str("request_id", requestID).Uint("assignment", assignmentID).Msg("Notification dropped, the notifier is shutting down")
+}
+
+// backlog returns how many notifications wait to be published
+func (n *notifier) backlog() int {
+	return len(n.queue)
+}
+
+// drain stops accepting notifications and waits until the queued ones are
+// published or the context expires.
+func (n *notifier) drain(ctx context.Context) error {
+	n.closeOnce.Do(func() {
+		close(n.stopping)
+		n.mu.Lock()
+		n.closed = true
+		close(n.queue)
+		n.mu.Unlock()
+	})
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d notifications not published: %w", len(n.queue), ctx.Err())
+	}
+}
+
+// checkNotifier verifies that the notification queue isn't full and that
+// the SNS topic can be reached.
+func checkNotifier(ctx context.Context, snsClient *sns.SNS, topicArn string) error {
+	if notifications != nil && notifications.backlog() == cap(notifications.queue) {
+		return fmt.Errorf("the queue is full with %d notifications", notifications.backlog())
+	}
+
+	_, err := snsClient.GetTopicAttributesWithContext(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(topicArn)})
+	return err
+}
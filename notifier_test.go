@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifierDrain(t *testing.T) {
+
+	var mu sync.Mutex
+	published := []string{}
+	n := newNotifier(func(ctx context.Context, message string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, message)
+		if message == "broken" {
+			return errors.New("sns unreachable")
+		}
+		return nil
+	}, time.Second, 10)
+
+	n.enqueue(context.Background(), 1, "req", "first")
+	n.enqueue(context.Background(), 1, "req", "broken")
+	n.enqueue(context.Background(), 2, "req", "second")
+	go n.run()
+
+	// Draining publishes everything queued, failures included
+	assert.NoError(t, n.drain(context.Background()))
+	assert.Equal(t, []string{"first", "broken", "second"}, published)
+	assert.NoError(t, n.drain(context.Background()))
+
+	// Late notifications are dropped rather than sent on the closed queue
+	n.enqueue(context.Background(), 3, "req", "late")
+	assert.Equal(t, []string{"first", "broken", "second"}, published)
+
+	// A stuck publisher gives up at the deadline
+	release := make(chan struct{})
+	stuck := newNotifier(func(ctx context.Context, message string) error {
+		<-release
+		return nil
+	}, time.Second, 10)
+	stuck.enqueue(context.Background(), 1, "req", "first")
+	stuck.enqueue(context.Background(), 1, "req", "second")
+	go stuck.run()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := stuck.drain(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(release)
+}
+
+func TestNotifierTimeout(t *testing.T) {
+
+	// Each publish gets its own deadline, so a hung one doesn't hold the queue
+	var mu sync.Mutex
+	errs := []error{}
+	n := newNotifier(func(ctx context.Context, message string) error {
+		<-ctx.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, ctx.Err())
+		return ctx.Err()
+	}, 10*time.Millisecond, 10)
+	n.enqueue(context.Background(), 1, "req", "first")
+	n.enqueue(context.Background(), 1, "req", "second")
+	go n.run()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, n.drain(ctx))
+	assert.Equal(t, []error{context.DeadlineExceeded, context.DeadlineExceeded}, errs)
+}
+
+func TestNotifierEnqueueWhileDraining(t *testing.T) {
+
+	// A request blocked on a full queue gives up once draining starts
+	release := make(chan struct{})
+	n := newNotifier(func(ctx context.Context, message string) error {
+		<-release
+		return nil
+	}, time.Second, 1)
+	n.enqueue(context.Background(), 1, "req", "first")
+
+	enqueued := make(chan struct{})
+	go func() {
+		n.enqueue(context.Background(), 1, "req", "second")
+		close(enqueued)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, n.drain(ctx), context.DeadlineExceeded)
+	select {
+	case <-enqueued:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue still blocked after draining started")
+	}
+	close(release)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"app/assignment/models"
+	_ "embed"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs/swagger-ui.html
+var swaggerUIPage []byte
+
+// apiOperation documents one route of the API. Bodies are described by
+// zero values of the models they are bound to or rendered from.
+type apiOperation struct {
+	Method     string
+	Path       string // gin path, e.g. /v1/assignments/:id
+	Summary    string
+	Tag        string
+	Public     bool // served without basic auth
+	Deprecated bool
+	Query      []string    // optional query parameters
+	Request    interface{} // JSON request body
+	Status     int         // status of a successful response
+	Response   interface{} // JSON response body, nil for none
+	CSV        bool        // request or response may also be text/csv
+}
+
+// Operations of every route registered by setupRouter
+var apiOperations = append(append([]apiOperation{
+	{Method: http.MethodGet, Path: "/healthz", Summary: "Check that the webapp can reach its database", Tag: "health", Public: true, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/livez", Summary: "Check that the process is up", Tag: "health", Public: true, Query: []string{"verbose"}, Status: http.StatusOK, Response: models.HealthReport{}},
+	{Method: http.MethodGet, Path: "/readyz", Summary: "Check that the webapp can take traffic", Tag: "health", Public: true, Query: []string{"verbose"}, Status: http.StatusOK, Response: models.HealthReport{}},
+	{Method: http.MethodGet, Path: "/metrics", Summary: "Prometheus metrics, when that backend is enabled", Tag: "health", Public: true, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/openapi.json", Summary: "OpenAPI document of the API", Tag: "docs", Public: true, Status: http.StatusOK, Response: map[string]interface{}{}},
+	{Method: http.MethodGet, Path: "/docs", Summary: "Swagger UI of the API", Tag: "docs", Public: true, Status: http.StatusOK},
+}, versionOperations(apiV1)...), versionOperations(apiV2)...)
+
+// Operations of the routes registered by registerAPIRoutes, relative to the
+// version prefix. Bodies are given in their v1 representation.
+var versionedOperations = []apiOperation{
+	{Method: http.MethodPost, Path: "/assignments", Summary: "Create a draft assignment", Tag: "assignments", Request: models.AssignmentInput{}, Status: http.StatusCreated, Response: models.AssignmentResponse{}},
+	{Method: http.MethodGet, Path: "/assignments", Summary: "List the assignments visible to the account", Tag: "assignments", Status: http.StatusOK, Response: []models.AssignmentResponse{}},
+	{Method: http.MethodGet, Path: "/assignments/export", Summary: "Export the assignments owned by the account", Tag: "assignments", Status: http.StatusOK, Response: []models.AssignmentInput{}, CSV: true},
+	{Method: http.MethodPost, Path: "/assignments/import", Summary: "Import assignments, all or nothing", Tag: "assignments", Query: []string{"dry_run"}, Request: []models.AssignmentInput{}, Status: http.StatusCreated, Response: models.AssignmentImportResponse{}, CSV: true},
+	{Method: http.MethodGet, Path: "/assignments/:id", Summary: "Get an assignment", Tag: "assignments", Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodPut, Path: "/assignments/:id", Summary: "Update an assignment", Tag: "assignments", Request: models.AssignmentInput{}, Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodPatch, Path: "/assignments/:id", Summary: "Not allowed, use PUT", Tag: "assignments", Status: http.StatusMethodNotAllowed},
+	{Method: http.MethodDelete, Path: "/assignments/:id", Summary: "Delete an assignment, with its submissions when forced", Tag: "assignments", Query: []string{"force"}, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/assignments/:id/submission", Summary: "Submit an assignment", Tag: "submissions", Request: models.SubmissionInput{}, Status: http.StatusOK, Response: models.SubmissionResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/submissions/:submissionId/grade", Summary: "Grade a submission", Tag: "submissions", Request: models.GradeInput{}, Status: http.StatusOK, Response: models.GradeResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/teams", Summary: "Create a team", Tag: "teams", Request: models.TeamInput{}, Status: http.StatusCreated, Response: models.TeamResponse{}},
+	{Method: http.MethodGet, Path: "/assignments/:id/teams", Summary: "List the teams of an assignment", Tag: "teams", Status: http.StatusOK, Response: []models.TeamResponse{}},
+	{Method: http.MethodDelete, Path: "/assignments/:id/teams/:teamId", Summary: "Delete a team", Tag: "teams", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/assignments/:id/teams/:teamId/join", Summary: "Join a team", Tag: "teams", Status: http.StatusOK, Response: models.TeamResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/teams/:teamId/leave", Summary: "Leave a team", Tag: "teams", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/assignments/:id/publish", Summary: "Publish a draft assignment", Tag: "lifecycle", Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/close", Summary: "Close a published assignment", Tag: "lifecycle", Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/archive", Summary: "Archive a closed assignment", Tag: "lifecycle", Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodGet, Path: "/assignments/:id/gradebook", Summary: "Gradebook of an assignment", Tag: "gradebook", Status: http.StatusOK, Response: []models.GradebookEntry{}, CSV: true},
+	{Method: http.MethodPost, Path: "/assignments/:id/extensions", Summary: "Grant an extension to a student", Tag: "extensions", Request: models.ExtensionInput{}, Status: http.StatusCreated, Response: models.ExtensionResponse{}},
+	{Method: http.MethodGet, Path: "/assignments/:id/extensions", Summary: "List the extensions of an assignment", Tag: "extensions", Status: http.StatusOK, Response: []models.ExtensionResponse{}},
+	{Method: http.MethodDelete, Path: "/assignments/:id/extensions/:extensionId", Summary: "Revoke an extension", Tag: "extensions", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/gradebook", Summary: "Gradebook of every assignment owned by the account", Tag: "gradebook", Status: http.StatusOK, Response: []models.GradebookEntry{}, CSV: true},
+	{Method: http.MethodPost, Path: "/assignments/:id/clone", Summary: "Clone an assignment, shifting its dates", Tag: "templates", Request: models.CloneInput{}, Status: http.StatusCreated, Response: models.AssignmentResponse{}},
+	{Method: http.MethodGet, Path: "/assignments/:id/revisions", Summary: "Revision history of an assignment", Tag: "revisions", Status: http.StatusOK, Response: []models.AssignmentRevisionResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/revisions/:revision/restore", Summary: "Bring an assignment back to a revision", Tag: "revisions", Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodPost, Path: "/assignments/:id/restore", Summary: "Undelete an assignment", Tag: "revisions", Status: http.StatusOK, Response: models.AssignmentResponse{}},
+	{Method: http.MethodPost, Path: "/templates", Summary: "Create a template, optionally from an assignment", Tag: "templates", Request: models.TemplateInput{}, Status: http.StatusCreated, Response: models.TemplateResponse{}},
+	{Method: http.MethodGet, Path: "/templates", Summary: "List the templates of the account", Tag: "templates", Status: http.StatusOK, Response: []models.TemplateResponse{}},
+	{Method: http.MethodGet, Path: "/templates/:id", Summary: "Get a template", Tag: "templates", Status: http.StatusOK, Response: models.TemplateResponse{}},
+	{Method: http.MethodDelete, Path: "/templates/:id", Summary: "Delete a template", Tag: "templates", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/templates/:id/instantiate", Summary: "Create assignments from a template", Tag: "templates", Request: models.InstantiateInput{}, Status: http.StatusCreated, Response: []models.AssignmentResponse{}},
+	{Method: http.MethodPost, Path: "/courses", Summary: "Create a course", Tag: "courses", Request: models.CourseInput{}, Status: http.StatusCreated, Response: models.CourseResponse{}},
+	{Method: http.MethodGet, Path: "/courses", Summary: "List the courses of the account", Tag: "courses", Status: http.StatusOK, Response: []models.CourseResponse{}},
+	{Method: http.MethodGet, Path: "/courses/:id", Summary: "Get a course", Tag: "courses", Status: http.StatusOK, Response: models.CourseResponse{}},
+	{Method: http.MethodPost, Path: "/courses/:id/enrollments", Summary: "Enroll an account in a course", Tag: "courses", Request: models.EnrollmentInput{}, Status: http.StatusCreated, Response: models.EnrollmentResponse{}},
+	{Method: http.MethodGet, Path: "/courses/:id/enrollments", Summary: "List the enrollments of a course", Tag: "courses", Status: http.StatusOK, Response: []models.EnrollmentResponse{}},
+	{Method: http.MethodPost, Path: "/courses/:id/enrollments/import", Summary: "Enroll accounts from a CSV document with email and role columns", Tag: "courses", Status: http.StatusOK, Response: models.EnrollmentImportResponse{}, CSV: true},
+	{Method: http.MethodDelete, Path: "/courses/:id/enrollments/:enrollmentId", Summary: "Remove an enrollment", Tag: "courses", Status: http.StatusNoContent},
+}
+
+// versionOperations prefixes the versioned operations with the given
+// version, swapping in the assignment representation of that version.
+func versionOperations(version string) []apiOperation {
+	operations := []apiOperation{}
+	for _, operation := range versionedOperations {
+		operation.Path = "/" + version + operation.Path
+		switch version {
+		case apiV1:
+			operation.Deprecated = true
+		case apiV2:
+			switch operation.Response.(type) {
+			case models.AssignmentResponse:
+				operation.Response = models.AssignmentResponseV2{}
+			case []models.AssignmentResponse:
+				operation.Response = []models.AssignmentResponseV2{}
+			}
+		}
+		operations = append(operations, operation)
+	}
+	return operations
+}
+
+var (
+	openAPIOnce     sync.Once
+	openAPIDocument map[string]interface{}
+)
+
+func getOpenAPI(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		openAPIDocument = buildOpenAPI(apiOperations)
+	})
+
+	c.JSON(http.StatusOK, openAPIDocument)
+}
+
+func getSwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUIPage)
+}
+
+var ginPathParam = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// openAPIPath turns a gin path into an OpenAPI path template
+func openAPIPath(path string) string {
+	return ginPathParam.ReplaceAllString(path, "{$1}")
+}
+
+// buildOpenAPI generates the OpenAPI 3 document of the given operations,
+// with the schemas of their bodies derived from the models.
+func buildOpenAPI(operations []apiOperation) map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]interface{}{}
+
+	problem := map[string]interface{}{
+		"description": "Problem details of the failed request",
+		"content": map[string]interface{}{
+			mimeProblemJSON: map[string]interface{}{"schema": schemas.ref(reflect.TypeOf(models.Problem{}))},
+		},
+	}
+
+	for _, operation := range operations {
+		path := openAPIPath(operation.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+
+		parameters := []interface{}{}
+		for _, match := range ginPathParam.FindAllStringSubmatch(operation.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "integer"},
+			})
+		}
+		for _, name := range operation.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name": name, "in": "query", "schema": map[string]interface{}{"type": "boolean"},
+			})
+		}
+
+		response := map[string]interface{}{"description": http.StatusText(operation.Status)}
+		if operation.Response != nil {
+			content := map[string]interface{}{
+				gin.MIMEJSON: map[string]interface{}{"schema": schemas.of(reflect.TypeOf(operation.Response))},
+			}
+			if operation.CSV {
+				content[mimeCSV] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			}
+			response["content"] = content
+		}
+
+		spec := map[string]interface{}{
+			"summary":     operation.Summary,
+			"operationId": strings.ToLower(operation.Method) + ginPathParam.ReplaceAllString(strings.ReplaceAll(operation.Path, "/", "_"), "by_$1"),
+			"tags":        []string{operation.Tag},
+			"parameters":  parameters,
+			"responses": map[string]interface{}{
+				strconv.Itoa(operation.Status): response,
+				"default":                      problem,
+			},
+		}
+		if operation.Public {
+			spec["security"] = []interface{}{}
+		}
+		if operation.Deprecated {
+			spec["deprecated"] = true
+		}
+		if operation.Request != nil || operation.CSV && operation.Method == http.MethodPost {
+			content := map[string]interface{}{}
+			if operation.Request != nil {
+				content[gin.MIMEJSON] = map[string]interface{}{"schema": schemas.of(reflect.TypeOf(operation.Request))}
+			}
+			if operation.CSV {
+				content[mimeCSV] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			}
+			spec["requestBody"] = map[string]interface{}{"required": true, "content": content}
+		}
+
+		paths[path][strings.ToLower(operation.Method)] = spec
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Assignment API",
+			"version":     "1.0.0",
+			"description": "Assignments, submissions, teams, courses and grading of the webapp.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"basicAuth": map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"basicAuth": []string{}}},
+	}
+}
+
+// openAPISchemas collects the component schemas of the model structs
+type openAPISchemas map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ref returns a reference to the component schema of a struct, generating it on first use
+func (s openAPISchemas) ref(t reflect.Type) map[string]interface{} {
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	if _, ok := s[t.Name()]; ok {
+		return ref
+	}
+
+	s[t.Name()] = map[string]interface{}{} // placeholder for recursive models
+	properties := map[string]interface{}{}
+	required := []string{}
+	s.addProperties(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	s[t.Name()] = schema
+	return ref
+}
+
+func (s openAPISchemas) addProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		// Embedded structs such as gorm.Model are flattened like encoding/json does
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			s.addProperties(field.Type, properties, required)
+			continue
+		}
+
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+
+		schema := s.of(field.Type)
+		rules := strings.Split(field.Tag.Get("binding"), ",")
+		for _, rule := range rules {
+			key, value, _ := strings.Cut(rule, "=")
+			switch key {
+			case "required":
+				*required = append(*required, name)
+			case "min", "max":
+				bound, _ := strconv.Atoi(value)
+				if field.Type.Kind() == reflect.String {
+					schema[key+"Length"] = bound
+				} else {
+					schema[map[string]string{"min": "minimum", "max": "maximum"}[key]] = bound
+				}
+			case "oneof":
+				schema["enum"] = strings.Fields(value)
+			case "url":
+				schema["format"] = "uri"
+			case "deadline", "future":
+				schema["format"] = "date-time"
+			}
+		}
+		properties[name] = schema
+	}
+}
+
+// of returns the schema of a type, structs being referenced from the components
+func (s openAPISchemas) of(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := s.of(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case t.Kind() == reflect.Struct && t.Name() == "DeletedAt":
+		return map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}
+	case t.Kind() == reflect.Struct:
+		return s.ref(t)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	default:
+		return map[string]interface{}{} // any value
+	}
+}
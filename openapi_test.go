@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+
+	router := setupRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var document struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+
+	// Every registered route is documented
+	documented := 0
+	for _, route := range router.Routes() {
+		operations := document.Paths[openAPIPath(route.Path)]
+		_, ok := operations[strings.ToLower(route.Method)]
+		assert.True(t, ok, "%s %s is missing from the OpenAPI document", route.Method, route.Path)
+		documented++
+	}
+
+	// and nothing else
+	operations := 0
+	for _, pathOperations := range document.Paths {
+		operations += len(pathOperations)
+	}
+	assert.Equal(t, documented, operations)
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+
+	document := buildOpenAPI(apiOperations)
+	schemas := document["components"].(map[string]interface{})["schemas"].(openAPISchemas)
+
+	// Schemas follow the JSON names and binding rules of the models
+	input := schemas["AssignmentInput"].(map[string]interface{})
+	assert.Contains(t, input["required"], "name")
+	points := input["properties"].(map[string]interface{})["points"].(map[string]interface{})
+	assert.Equal(t, "integer", points["type"])
+	assert.Equal(t, 100, points["maximum"])
+
+	submission := schemas["SubmissionInput"].(map[string]interface{})
+	url := submission["properties"].(map[string]interface{})["submission_url"].(map[string]interface{})
+	assert.Equal(t, "uri", url["format"])
+
+	assert.Contains(t, schemas, "Problem")
+}
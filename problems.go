@@ -0,0 +1,84 @@
+package main
+
+import (
+	"app/assignment/models"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// problemError is an error answered with a problem document by problemMiddleware
+type problemError struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []string
+
+	InvalidFields []models.FieldError
+	Submissions   []uint
+}
+
+func (e *problemError) Error() string {
+	return e.Code + ": " + e.Detail
+}
+
+// abortWithProblem stops the request and leaves the problem to be answered
+// by problemMiddleware.
+func abortWithProblem(c *gin.Context, status int, code string, detail string) {
+	abortWithError(c, &problemError{Status: status, Code: code, Detail: detail})
+}
+
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// problemMiddleware answers the requests that ended with an error and no
+// response as application/problem+json. Errors other than problemError are
+// answered as internal errors without exposing their message.
+func problemMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		var problem *problemError
+		if err := c.Errors.Last().Err; !errors.As(err, &problem) {
+			requestLogger(c).Error().Err(err).Msg("Request failed with an unexpected error")
+			problem = &problemError{Status: http.StatusInternalServerError, Code: "INTERNAL_ERROR", Detail: "An unexpected error occured"}
+		}
+
+		// The JSON renderer keeps a content type that is already set
+		c.Header("Content-Type", mimeProblemJSON)
+		c.JSON(problem.Status, newProblem(c, problem))
+	}
+}
+
+func newProblem(c *gin.Context, problem *problemError) models.Problem {
+	return models.Problem{
+		Type:      "/problems/" + strings.ReplaceAll(strings.ToLower(problem.Code), "_", "-"),
+		Title:     http.StatusText(problem.Status),
+		Status:    problem.Status,
+		Detail:    problem.Detail,
+		Code:      problem.Code,
+		RequestID: requestID(c),
+		Errors:    problem.Errors,
+
+		InvalidFields: problem.InvalidFields,
+		Submissions:   problem.Submissions,
+	}
+}
+
+func notFound(c *gin.Context) {
+	abortWithProblem(c, http.StatusNotFound, "ROUTE_NOT_FOUND", "No endpoint matches "+c.Request.Method+" "+c.Request.URL.Path)
+}
+
+func methodNotAllowed(c *gin.Context) {
+	abortWithProblem(c, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemMiddleware(t *testing.T) {
+
+	router := gin.New()
+	router.Use(problemMiddleware())
+	router.NoRoute(notFound)
+	router.GET("/problem", func(c *gin.Context) {
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+	})
+	router.GET("/failure", func(c *gin.Context) {
+		abortWithError(c, errors.New("connection refused"))
+	})
+
+	// Problems are rendered as problem+json with the ID of the request
+	req := httptest.NewRequest(http.MethodGet, "/problem", nil)
+	req.Header.Set(requestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, mimeProblemJSON, w.Header().Get("Content-Type"))
+	var problem models.Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, models.Problem{
+		Type:      "/problems/assignment-not-found",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    "Assignment not found",
+		Code:      "ASSIGNMENT_NOT_FOUND",
+		RequestID: "abc",
+	}, problem)
+
+	// Other errors don't leak their message
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/failure", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	assert.Contains(t, w.Body.String(), `"code":"INTERNAL_ERROR"`)
+
+	// Unknown routes are problems as well
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"ROUTE_NOT_FOUND"`)
+}
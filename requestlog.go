@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Context key and header carrying the ID of a request
+const (
+	requestIDKey    = "request_id"
+	requestIDHeader = "X-Request-ID"
+)
+
+// IDs accepted from clients, anything else is replaced to keep logs clean
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:=+/-]{1,128}$`)
+
+// requestLogMiddleware gives every request an ID, kept from the
+// X-Request-ID header when the client or load balancer sent a valid one
+// and echoed in the response. It attaches a logger carrying the ID to the
+// request context and logs one line per request once it is answered.
+func requestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+
+		fields := log.With().
+			Str("request_id", id).
+			Str("ip", c.ClientIP()).
+			Str("http_method", c.Request.Method).
+			Str("route", c.FullPath())
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			fields = fields.Str("trace_id", span.TraceID().String())
+		}
+		logger := fields.Logger()
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		event := logger.Info()
+		switch {
+		case status >= 500:
+			event = logger.Error()
+		case status >= 400:
+			event = logger.Warn()
+		}
+		event.
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("size", c.Writer.Size()).
+			Str("user_agent", c.Request.UserAgent()).
+			Msg("Request handled")
+	}
+}
+
+// newRequestID returns a random 128 bit ID
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// requestID returns the ID of the request, as set by the request ID
+// middleware or given by the client.
+func requestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+	return c.GetHeader(requestIDHeader)
+}
+
+// requestLogger returns the logger of the request, carrying its ID, or the
+// global logger outside of requestLogMiddleware.
+func requestLogger(c *gin.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(c.Request.Context()); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &log.Logger
+}
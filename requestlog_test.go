@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogMiddleware(t *testing.T) {
+
+	var output bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&output)
+	defer func() { log.Logger = logger }()
+
+	router := gin.New()
+	router.Use(requestLogMiddleware(), problemMiddleware())
+	router.GET("/v1/assignments/:id", func(c *gin.Context) {
+		requestLogger(c).Info().Msg("GetAnAssignment Endpoint")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+	})
+
+	lines := func() []map[string]interface{} {
+		entries := []map[string]interface{}{}
+		scanner := bufio.NewScanner(&output)
+		for scanner.Scan() {
+			entry := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			entries = append(entries, entry)
+		}
+		output.Reset()
+		return entries
+	}
+
+	// The ID of the load balancer is kept, echoed and on every line
+	req := httptest.NewRequest(http.MethodGet, "/v1/assignments/7", nil)
+	req.Header.Set(requestIDHeader, "Root=1-65a1b2c3-abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "Root=1-65a1b2c3-abc", w.Header().Get(requestIDHeader))
+	assert.Contains(t, w.Body.String(), `"request_id":"Root=1-65a1b2c3-abc"`)
+	entries := lines()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "GetAnAssignment Endpoint", entries[0]["message"])
+	assert.Equal(t, "Root=1-65a1b2c3-abc", entries[0]["request_id"])
+	assert.Equal(t, "/v1/assignments/:id", entries[0]["route"])
+
+	// followed by one access log line
+	access := entries[1]
+	assert.Equal(t, "Request handled", access["message"])
+	assert.Equal(t, "warn", access["level"])
+	assert.Equal(t, "Root=1-65a1b2c3-abc", access["request_id"])
+	assert.Equal(t, "GET", access["http_method"])
+	assert.Equal(t, "/v1/assignments/7", access["path"])
+	assert.Equal(t, float64(http.StatusNotFound), access["status"])
+	assert.Contains(t, access, "latency")
+
+	// IDs that could forge log lines are replaced
+	req = httptest.NewRequest(http.MethodGet, "/v1/assignments/7", nil)
+	req.Header.Set(requestIDHeader, "abc\n{\"level\":\"error\"}")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	id := w.Header().Get(requestIDHeader)
+	assert.Regexp(t, "^[0-9a-f]{32}$", id)
+	for _, entry := range lines() {
+		assert.Equal(t, id, entry["request_id"])
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Revision actions that aren't a status transition
+const (
+	revisionCreate  = "create"
+	revisionUpdate  = "update"
+	revisionDelete  = "delete"
+	revisionRestore = "restore"
+	revisionRevert  = "revert"
+)
+
+// recordRevision appends a revision of the assignment, as it is now, within
+// the given transaction along with the fields changed since the previous one.
+// The assignment is locked until the end of the transaction so that
+// concurrent changes are numbered one after the other.
+func recordRevision(tx *gorm.DB, accountID uint, action string, assignment models.Assignment) error {
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Assignment{}, assignment.ID).Error; err != nil {
+		return err
+	}
+
+	var previous models.AssignmentRevision
+	err := tx.Where("assignment_id = ?", assignment.ID).Order("revision DESC").First(&previous).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	revision := models.AssignmentRevision{
+		AssignmentID: assignment.ID,
+		Revision:     previous.Revision + 1,
+		AccountID:    accountID,
+		Action:       action,
+		Status:       assignment.Status,
+		Snapshot:     assignmentInputFromAssignment(assignment),
+		Changes:      []models.FieldChange{},
+	}
+	if previous.Revision > 0 {
+		revision.Changes, err = assignmentChanges(previous, revision)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&revision).Error
+}
+
+// assignmentChanges lists the fields that differ between two revisions, in
+// the JSON names of the assignment input.
+func assignmentChanges(before models.AssignmentRevision, after models.AssignmentRevision) ([]models.FieldChange, error) {
+	beforeFields, err := revisionFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := revisionFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for field := range afterFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			changes = append(changes, models.FieldChange{Field: field, From: beforeFields[field], To: afterFields[field]})
+		}
+	}
+	return changes, nil
+}
+
+func revisionFields(revision models.AssignmentRevision) (map[string]interface{}, error) {
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(snapshot, &fields); err != nil {
+		return nil, err
+	}
+	fields["status"] = revision.Status
+	return fields, nil
+}
+
+func getRevisions(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getrevisions_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetRevisions Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetRevisions Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	// The history of deleted assignments stays available to their owner
+	assignment, ok := findOwnedDeletedAssignment(c, "GetRevisions", userID, false)
+	if !ok {
+		return
+	}
+
+	var revisions []models.AssignmentRevision
+	if err := requestDB(c).Where("assignment_id = ?", assignment.ID).Order("revision").Find(&revisions).Error; err != nil {
+		err := errors.New("REVISION RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetRevisions Endpoint:Unable to retrieve revisions from database")
+		abortWithProblem(c, http.StatusInternalServerError, "REVISION_RETRIEVAL_ERROR", "Unable to retrieve revisions from database")
+		return
+	}
+
+	revisionResponses := []models.AssignmentRevisionResponse{}
+	for _, revision := range revisions {
+		revisionResponses = append(revisionResponses, newRevisionResponse(revision))
+	}
+
+	requestLogger(c).Info().Msg("GetRevisions Endpoint:Successfully retrieved the revisions")
+
+	c.JSON(http.StatusOK, revisionResponses)
+}
+
+// revertAssignment brings the fields of an assignment back to a previous
+// revision. The status of the assignment is left as it is.
+func revertAssignment(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("revertassignment_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("RevertAssignment Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("RevertAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "RevertAssignment", userID)
+	if !ok {
+		return
+	}
+
+	revisionNumber, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		err := errors.New("INVALID REVISION")
+		requestLogger(c).Error().Err(err).Msg("RevertAssignment Endpoint:The revision is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_REVISION", "Invalid revision")
+		return
+	}
+
+	var revision models.AssignmentRevision
+	if err := requestDB(c).Where("assignment_id = ? AND revision = ?", assignment.ID, revisionNumber).First(&revision).Error; err != nil {
+		err := errors.New("REVISION NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("RevertAssignment Endpoint:The revision doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found")
+		return
+	}
+
+	// The rules may have changed since the revision was taken
+	input := revision.Snapshot
+	if err := validateAssignmentInput(&input); err != nil {
+		requestLogger(c).Error().Err(err).Msg("RevertAssignment Endpoint:The revision is no longer a valid assignment")
+		abortWithInvalidInput(c, "INVALID_ASSIGNMENT", err)
+		return
+	}
+	publishAt, _ := parsePublishAt(input.PublishAt)
+	rubricChanged := !reflect.DeepEqual(assignmentInputFromAssignment(assignment).Rubric, input.Rubric)
+	applyAssignmentInput(&assignment, input, publishAt)
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Rubric").Save(&assignment).Error; err != nil {
+			return err
+		}
+		if rubricChanged {
+			if err := replaceRubric(tx, &assignment, input.Rubric); err != nil {
+				return err
+			}
+		}
+		if err := recordRevision(tx, userID, revisionRevert, assignment); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "assignment.revert", "assignment", assignment.ID, gin.H{"revision": revision.Revision})
+	})
+	if err == errRubricInUse {
+		requestLogger(c).Error().Err(err).Msg("RevertAssignment Endpoint:The rubric is already used to grade submissions")
+		abortWithProblem(c, http.StatusConflict, "RUBRIC_IN_USE", "The rubric can't be changed once submissions have been graded with it")
+		return
+	}
+	if err != nil {
+		err := errors.New("UPDATE ERROR")
+		requestLogger(c).Error().Err(err).Msg("RevertAssignment Endpoint:Failed to revert the assignment")
+		abortWithProblem(c, http.StatusInternalServerError, "UPDATE_ERROR", "Failed to revert the assignment")
+		return
+	}
+
+	requestLogger(c).Info().Int("revision", revision.Revision).Msg("RevertAssignment Endpoint:Successfully reverted the assignment")
+
+	renderAssignment(c, http.StatusOK, assignment)
+}
+
+// restoreAssignment undeletes a soft-deleted assignment
+func restoreAssignment(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("restoreassignment_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("RestoreAssignment Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("RestoreAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedDeletedAssignment(c, "RestoreAssignment", userID, true)
+	if !ok {
+		return
+	}
+
+	deletedAt := assignment.DeletedAt
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&assignment).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		// Rows deleted along with the assignment come back with it, those
+		// deleted on their own before stay deleted
+		if _, err := setAssignmentRowsDeletedAt(tx, assignment.ID, deletedAt, gorm.DeletedAt{}); err != nil {
+			return err
+		}
+		assignment.DeletedAt = gorm.DeletedAt{}
+		if err := recordRevision(tx, userID, revisionRestore, assignment); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "assignment.restore", "assignment", assignment.ID, nil)
+	})
+	if err != nil {
+		err := errors.New("RESTORE ERROR")
+		requestLogger(c).Error().Err(err).Msg("RestoreAssignment Endpoint:Failed to restore the assignment")
+		abortWithProblem(c, http.StatusInternalServerError, "RESTORE_ERROR", "Failed to restore the assignment")
+		return
+	}
+
+	requestLogger(c).Info().Msg("RestoreAssignment Endpoint:Successfully restored the assignment")
+
+	renderAssignment(c, http.StatusOK, assignment)
+}
+
+// setAssignmentRowsDeletedAt moves the rows belonging to the assignment from
+// one deletion time to another: its submissions and their rubric scores,
+// extensions and teams. An invalid time stands for rows that aren't deleted.
+// The update time of the rows is left as it is. The rows moved, other than
+// the submissions, are counted.
+func setAssignmentRowsDeletedAt(tx *gorm.DB, assignmentID uint, from gorm.DeletedAt, to gorm.DeletedAt) (models.CascadedRows, error) {
+	var cascaded models.CascadedRows
+	var submissionRows int64
+	submissions := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.Submission{}).Select("id").Where("assignment_id = ?", assignmentID)
+
+	for _, table := range []struct {
+		rows  *gorm.DB
+		count *int64
+	}{
+		{tx.Unscoped().Model(&models.CriterionScore{}).Where("submission_id IN (?)", submissions), &cascaded.RubricScores},
+		{tx.Unscoped().Model(&models.Submission{}).Where("assignment_id = ?", assignmentID), &submissionRows},
+		{tx.Unscoped().Model(&models.Extension{}).Where("assignment_id = ?", assignmentID), &cascaded.Extensions},
+		{tx.Unscoped().Model(&models.TeamMember{}).Where("assignment_id = ?", assignmentID), &cascaded.TeamMembers},
+		{tx.Unscoped().Model(&models.Team{}).Where("assignment_id = ?", assignmentID), &cascaded.Teams},
+	} {
+		// <=> matches NULL as well
+		result := table.rows.Where("deleted_at <=> ?", from).UpdateColumn("deleted_at", to)
+		if result.Error != nil {
+			return cascaded, result.Error
+		}
+		*table.count = result.RowsAffected
+	}
+
+	return cascaded, nil
+}
+
+// findOwnedDeletedAssignment loads the assignment referenced by the id
+// parameter whether it is deleted or not, and checks that the account owns
+// it. With deletedOnly, assignments that aren't deleted are a conflict. When
+// the assignment can't be used, the error response is written and false is
+// returned.
+func findOwnedDeletedAssignment(c *gin.Context, endpoint string, userID uint, deletedOnly bool) (models.Assignment, bool) {
+	var assignment models.Assignment
+
+	assignmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID ASSIGNMENT ID")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_ASSIGNMENT_ID", "Invalid assignment ID")
+		return assignment, false
+	}
+
+	if err := withRubric(requestDB(c).Unscoped()).First(&assignment, assignmentID).Error; err != nil {
+		err := errors.New("ASSIGNMENT NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+		return assignment, false
+	}
+
+	// Check if the authenticated user is the owner of the assignment
+	if assignment.AccountID != userID {
+		err := errors.New("AUTHORIZATION ERROR")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The user is not the owner of this assignment")
+		abortWithProblem(c, http.StatusForbidden, "AUTHORIZATION_ERROR", "You are not authorized to manage this assignment")
+		return assignment, false
+	}
+
+	if deletedOnly && !assignment.DeletedAt.Valid {
+		err := errors.New("ASSIGNMENT NOT DELETED")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment isn't deleted")
+		abortWithProblem(c, http.StatusConflict, "ASSIGNMENT_NOT_DELETED", "Assignment isn't deleted")
+		return assignment, false
+	}
+
+	return assignment, true
+}
+
+func newRevisionResponse(revision models.AssignmentRevision) models.AssignmentRevisionResponse {
+	changes := revision.Changes
+	if changes == nil {
+		changes = []models.FieldChange{}
+	}
+
+	return models.AssignmentRevisionResponse{
+		Revision:  revision.Revision,
+		AccountID: revision.AccountID,
+		Action:    revision.Action,
+		Status:    revision.Status,
+		Changes:   changes,
+		Snapshot:  revision.Snapshot,
+		Created:   revision.CreatedAt.String(),
+	}
+}
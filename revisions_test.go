@@ -0,0 +1,129 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignmentChanges(t *testing.T) {
+
+	before := models.AssignmentRevision{
+		Status:   models.AssignmentStatusDraft,
+		Snapshot: models.AssignmentInput{Name: "Lab 1", Points: 10, NoOfAttempts: 1, Deadline: "2024-01-10T23:59:00.000Z"},
+	}
+	after := before
+	after.Snapshot.Points = 20
+	after.Snapshot.Rubric = []models.RubricCriterionInput{{Name: "Design", Weight: 20}}
+	after.Status = models.AssignmentStatusPublished
+
+	// Only the changed fields are listed, sorted by name
+	changes, err := assignmentChanges(before, after)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, []string{"points", "rubric", "status"}, []string{changes[0].Field, changes[1].Field, changes[2].Field})
+	assert.Equal(t, 10.0, changes[0].From)
+	assert.Equal(t, 20.0, changes[0].To)
+
+	changes, err = assignmentChanges(after, after)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestRevertAssignment(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	other := testAccount(t, "other@example.com")
+	assignment := testAssignment(t, owner, nil)
+	require.NoError(t, recordRevision(db, owner.ID, revisionCreate, assignment))
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10)
+
+	input := assignmentInputFromAssignment(assignment)
+	input.Name = "Lab 1, second take"
+	input.Points = 20
+	w := testRequest(router, http.MethodPut, path, owner.Email, input)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = testRequest(router, http.MethodPost, path+"/revisions/1/restore", other.Email, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = testRequest(router, http.MethodPost, path+"/revisions/9/restore", owner.Email, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = testRequest(router, http.MethodPost, path+"/revisions/1/restore", owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var reverted models.AssignmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reverted))
+	assert.Equal(t, "Lab 1", reverted.Name)
+	assert.Equal(t, 10, reverted.Points)
+
+	w = testRequest(router, http.MethodGet, path+"/revisions", owner.Email, nil)
+	var revisions []models.AssignmentRevisionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+	require.Len(t, revisions, 3)
+	assert.Equal(t, revisionRevert, revisions[2].Action)
+	assert.Equal(t, []string{"name", "points"}, []string{revisions[2].Changes[0].Field, revisions[2].Changes[1].Field})
+
+	// Snapshots that no longer pass validation aren't written back
+	invalid := assignmentInputFromAssignment(assignment)
+	invalid.LatePolicy = models.LatePolicyLateUntil
+	require.NoError(t, db.Create(&models.AssignmentRevision{AssignmentID: assignment.ID, Revision: 4, AccountID: owner.ID, Action: revisionUpdate, Status: assignment.Status, Snapshot: invalid}).Error)
+	w = testRequest(router, http.MethodPost, path+"/revisions/4/restore", owner.Email, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	var stored models.Assignment
+	require.NoError(t, db.First(&stored, assignment.ID).Error)
+	assert.Equal(t, models.LatePolicyHardCutoff, stored.LatePolicy)
+
+	// Revision numbers are unique within the assignment
+	err := db.Create(&models.AssignmentRevision{AssignmentID: assignment.ID, Revision: 4, AccountID: owner.ID, Action: revisionUpdate, Status: assignment.Status, Snapshot: input}).Error
+	assert.True(t, isDuplicateEntry(err), "%v", err)
+}
+
+func TestRestoreAssignment(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	other := testAccount(t, "other@example.com")
+	assignment := testAssignment(t, owner, nil)
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10)
+
+	// Replaced criteria stay deleted when the assignment is restored
+	require.NoError(t, replaceRubric(db, &assignment, []models.RubricCriterionInput{{Name: "Old", Weight: 10}}))
+	require.NoError(t, replaceRubric(db, &assignment, []models.RubricCriterionInput{{Name: "Design", Weight: 4}, {Name: "Tests", Weight: 6}}))
+
+	w := testRequest(router, http.MethodPost, path+"/restore", owner.Email, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = testRequest(router, http.MethodDelete, path, owner.Email, nil)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	w = testRequest(router, http.MethodGet, path, owner.Email, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = testRequest(router, http.MethodPost, path+"/restore", other.Email, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testRequest(router, http.MethodPost, path+"/restore", owner.Email, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var restored models.AssignmentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &restored))
+	require.Len(t, restored.Rubric, 2)
+	assert.Equal(t, "Design", restored.Rubric[0].Name)
+	assert.Equal(t, "Tests", restored.Rubric[1].Name)
+
+	w = testRequest(router, http.MethodGet, path, owner.Email, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var revisions []models.AssignmentRevision
+	require.NoError(t, db.Where("assignment_id = ?", assignment.ID).Order("revision").Find(&revisions).Error)
+	require.NotEmpty(t, revisions)
+	assert.Equal(t, revisionRestore, revisions[len(revisions)-1].Action)
+	assert.Len(t, revisions[len(revisions)-1].Snapshot.Rubric, 2)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errRubricInUse = errors.New("RUBRIC IN USE")
+
+// validateRubric checks the rubric of an assignment input against its points
+func validateRubric(input *models.AssignmentInput) error {
+	if len(input.Rubric) == 0 {
+		return nil
+	}
+
+	total := 0
+	for i, criterion := range input.Rubric {
+		if criterion.Name == "" {
+			return fmt.Errorf("rubric criterion %d needs a name", i+1)
+		}
+		if criterion.Weight <= 0 {
+			return fmt.Errorf("weight of rubric criterion %q should be greater than 0", criterion.Name)
+		}
+		for _, level := range criterion.Levels {
+			if level.Points < 0 || level.Points > criterion.Weight {
+				return fmt.Errorf("levels of rubric criterion %q should be worth between 0 and %d points", criterion.Name, criterion.Weight)
+			}
+		}
+		total += criterion.Weight
+	}
+
+	if total != input.Points {
+		return fmt.Errorf("weights of the rubric add up to %d instead of the %d points of the assignment", total, input.Points)
+	}
+
+	return nil
+}
+
+func rubricFromInput(inputs []models.RubricCriterionInput) []models.RubricCriterion {
+	rubric := []models.RubricCriterion{}
+	for _, input := range inputs {
+		rubric = append(rubric, models.RubricCriterion{
+			Name:        input.Name,
+			Description: input.Description,
+			Weight:      input.Weight,
+			Levels:      input.Levels,
+		})
+	}
+	return rubric
+}
+
+func newRubricResponse(rubric []models.RubricCriterion) []models.RubricCriterionResponse {
+	rubricResponse := []models.RubricCriterionResponse{}
+	for _, criterion := range rubric {
+		rubricResponse = append(rubricResponse, models.RubricCriterionResponse{
+			ID:          criterion.ID,
+			Name:        criterion.Name,
+			Description: criterion.Description,
+			Weight:      criterion.Weight,
+			Levels:      criterion.Levels,
+		})
+	}
+	return rubricResponse
+}
+
+// withRubric preloads the rubric of the assignments loaded by the query
+func withRubric(query *gorm.DB) *gorm.DB {
+	// Unscoped queries of deleted assignments would preload replaced criteria too
+	return query.Preload("Rubric", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("rubric_criterions.deleted_at IS NULL").Order("rubric_criterions.id")
+	})
+}
+
+// replaceRubric swaps the rubric of an assignment for the given one. Rubrics
+// of assignments that already have graded submissions can't be replaced.
+func replaceRubric(tx *gorm.DB, assignment *models.Assignment, inputs []models.RubricCriterionInput) error {
+	var graded int64
+	err := tx.Model(&models.CriterionScore{}).
+		Joins("JOIN rubric_criterions ON rubric_criterions.id = criterion_scores.criterion_id").
+		Where("rubric_criterions.assignment_id = ?", assignment.ID).
+		Count(&graded).Error
+	if err != nil {
+		return err
+	}
+	if graded > 0 {
+		return errRubricInUse
+	}
+
+	if err := tx.Where("assignment_id = ?", assignment.ID).Delete(&models.RubricCriterion{}).Error; err != nil {
+		return err
+	}
+
+	assignment.Rubric = rubricFromInput(inputs)
+	for i := range assignment.Rubric {
+		assignment.Rubric[i].AssignmentID = assignment.ID
+	}
+	if len(assignment.Rubric) == 0 {
+		return nil
+	}
+
+	return tx.Create(&assignment.Rubric).Error
+}
+
+func gradeSubmission(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("gradesubmission_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GradeSubmission Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GradeSubmission Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	// Only the owner of the assignment grades its submissions
+	assignment, ok := findOwnedAssignment(c, "GradeSubmission", userID)
+	if !ok {
+		return
+	}
+
+	submissionID, err := strconv.ParseUint(c.Param("submissionId"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID SUBMISSION ID")
+		requestLogger(c).Error().Err(err).Msg("GradeSubmission Endpoint:The submission ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_SUBMISSION_ID", "Invalid submission ID")
+		return
+	}
+
+	var submission models.Submission
+	if err := requestDB(c).Where("id = ? AND assignment_id = ?", submissionID, assignment.ID).First(&submission).Error; err != nil {
+		err := errors.New("SUBMISSION NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg("GradeSubmission Endpoint:The submission doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "SUBMISSION_NOT_FOUND", "Submission not found")
+		return
+	}
+
+	var input models.GradeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("GradeSubmission Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The request body is incorrect")
+		return
+	}
+
+	scores, total, err := computeGrade(assignment, input)
+	if err != nil {
+		requestLogger(c).Error().Err(err).Msg("GradeSubmission Endpoint:The grade is invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_GRADE", err.Error())
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("submission_id = ?", submission.ID).Delete(&models.CriterionScore{}).Error; err != nil {
+			return err
+		}
+		for i := range scores {
+			scores[i].SubmissionID = submission.ID
+			scores[i].GraderID = userID
+		}
+		if len(scores) > 0 {
+			if err := tx.Create(&scores).Error; err != nil {
+				return err
+			}
+		}
+
+		submission.Score = &total
+		if err := tx.Model(&submission).Update("score", total).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "submission.grade", "submission", submission.ID, input)
+	})
+	if err != nil {
+		err := errors.New("GRADE ERROR")
+		requestLogger(c).Error().Err(err).Msg("GradeSubmission Endpoint:Failed to save the grade")
+		abortWithProblem(c, http.StatusInternalServerError, "GRADE_ERROR", "Failed to save the grade")
+		return
+	}
+
+	gradeResp := models.GradeResponse{
+		SubmissionID: submission.ID,
+		Score:        total,
+		LatePenalty:  submission.LatePenalty,
+		FinalScore:   total * (100 - submission.LatePenalty) / 100,
+		Scores:       []models.CriterionScoreInput{},
+	}
+	for _, score := range scores {
+		gradeResp.Scores = append(gradeResp.Scores, models.CriterionScoreInput{CriterionID: score.CriterionID, Points: score.Points, Comment: score.Comment})
+	}
+
+	requestLogger(c).Info().Msg("GradeSubmission Endpoint:Successfully graded the submission")
+
+	c.JSON(http.StatusOK, gradeResp)
+}
+
+// computeGrade validates a grade against the rubric of the assignment and
+// returns the criterion scores along with the total score.
+func computeGrade(assignment models.Assignment, input models.GradeInput) ([]models.CriterionScore, float64, error) {
+	scores := []models.CriterionScore{}
+
+	// Assignments without a rubric are graded with a single score
+	if len(assignment.Rubric) == 0 {
+		if input.Score == nil || len(input.Scores) > 0 {
+			return scores, 0, errors.New("assignment has no rubric, grade it with a single score")
+		}
+		if *input.Score < 0 || *input.Score > float64(assignment.Points) {
+			return scores, 0, fmt.Errorf("score should be between 0 and %d", assignment.Points)
+		}
+		return scores, *input.Score, nil
+	}
+
+	if input.Score != nil {
+		return scores, 0, errors.New("assignment has a rubric, grade every criterion instead of a single score")
+	}
+
+	given := map[uint]models.CriterionScoreInput{}
+	for _, score := range input.Scores {
+		if _, ok := given[score.CriterionID]; ok {
+			return scores, 0, fmt.Errorf("criterion %d is scored more than once", score.CriterionID)
+		}
+		given[score.CriterionID] = score
+	}
+
+	total := 0.0
+	for _, criterion := range assignment.Rubric {
+		score, ok := given[criterion.ID]
+		if !ok {
+			return scores, 0, fmt.Errorf("criterion %q is not scored", criterion.Name)
+		}
+		if score.Points < 0 || score.Points > float64(criterion.Weight) {
+			return scores, 0, fmt.Errorf("score of criterion %q should be between 0 and %d", criterion.Name, criterion.Weight)
+		}
+		delete(given, criterion.ID)
+
+		total += score.Points
+		scores = append(scores, models.CriterionScore{CriterionID: criterion.ID, Points: score.Points, Comment: score.Comment})
+	}
+
+	for id := range given {
+		return scores, 0, fmt.Errorf("criterion %d is not part of the rubric", id)
+	}
+
+	if total > float64(assignment.Points) {
+		return scores, 0, fmt.Errorf("total score %s exceeds the %d points of the assignment", strconv.FormatFloat(total, 'f', -1, 64), assignment.Points)
+	}
+
+	return scores, math.Round(total*100) / 100, nil
+}
+
+// rubricScores returns the criterion scores of the given submissions for the
+// gradebook in a single query, by submission ID. Scores of criteria removed
+// from the rubric since are left out.
+func rubricScores(tx *gorm.DB, submissionIDs []uint) (map[uint][]models.RubricScore, error) {
+	scores := map[uint][]models.RubricScore{}
+	if len(submissionIDs) == 0 {
+		return scores, nil
+	}
+
+	var rows []struct {
+		SubmissionID uint
+		Name         string
+		Points       float64
+	}
+	err := tx.Table("criterion_scores").
+		Select("criterion_scores.submission_id, rubric_criterions.name, criterion_scores.points").
+		Joins("JOIN rubric_criterions ON rubric_criterions.id = criterion_scores.criterion_id AND rubric_criterions.deleted_at IS NULL").
+		Where("criterion_scores.submission_id IN ? AND criterion_scores.deleted_at IS NULL", submissionIDs).
+		Order("criterion_scores.submission_id, criterion_scores.criterion_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		scores[row.SubmissionID] = append(scores[row.SubmissionID], models.RubricScore{Criterion: row.Name, Points: row.Points})
+	}
+	return scores, nil
+}
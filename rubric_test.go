@@ -0,0 +1,67 @@
+package main
+
+import (
+	"app/assignment/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeGrade(t *testing.T) {
+
+	assignment := models.Assignment{Points: 10}
+	assignment.Rubric = []models.RubricCriterion{{Name: "Design", Weight: 6}, {Name: "Tests", Weight: 4}}
+	assignment.Rubric[0].ID = 1
+	assignment.Rubric[1].ID = 2
+
+	// Every criterion is scored and the total computed
+	scores, total, err := computeGrade(assignment, models.GradeInput{Scores: []models.CriterionScoreInput{
+		{CriterionID: 1, Points: 5},
+		{CriterionID: 2, Points: 3.5},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, scores, 2)
+	assert.Equal(t, 8.5, total)
+
+	// Missing criteria, unknown criteria and scores above the weight are rejected
+	_, _, err = computeGrade(assignment, models.GradeInput{Scores: []models.CriterionScoreInput{{CriterionID: 1, Points: 5}}})
+	assert.Error(t, err)
+
+	_, _, err = computeGrade(assignment, models.GradeInput{Scores: []models.CriterionScoreInput{
+		{CriterionID: 1, Points: 5}, {CriterionID: 2, Points: 3}, {CriterionID: 3, Points: 1},
+	}})
+	assert.Error(t, err)
+
+	_, _, err = computeGrade(assignment, models.GradeInput{Scores: []models.CriterionScoreInput{
+		{CriterionID: 1, Points: 7}, {CriterionID: 2, Points: 3},
+	}})
+	assert.Error(t, err)
+
+	// Assignments without a rubric take a single score within their points
+	score := 9.0
+	_, total, err = computeGrade(models.Assignment{Points: 10}, models.GradeInput{Score: &score})
+	assert.NoError(t, err)
+	assert.Equal(t, 9.0, total)
+
+	score = 11
+	_, _, err = computeGrade(models.Assignment{Points: 10}, models.GradeInput{Score: &score})
+	assert.Error(t, err)
+}
+
+func TestValidateRubric(t *testing.T) {
+
+	input := models.AssignmentInput{Points: 10, Rubric: []models.RubricCriterionInput{
+		{Name: "Design", Weight: 6, Levels: []models.RubricLevel{{Label: "Good", Points: 6}, {Label: "Poor", Points: 2}}},
+		{Name: "Tests", Weight: 4},
+	}}
+	assert.NoError(t, validateRubric(&input))
+
+	// Weights have to add up to the points of the assignment
+	input.Points = 12
+	assert.Error(t, validateRubric(&input))
+
+	// Levels can't be worth more than their criterion
+	input.Points = 10
+	input.Rubric[0].Levels[0].Points = 7
+	assert.Error(t, validateRubric(&input))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// secretsConfig holds the settings of the secret providers
+type secretsConfig struct {
+	Region          string        `yaml:"region"`           // of Secrets Manager
+	Endpoint        string        `yaml:"endpoint"`         // of Secrets Manager, AWS when empty
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // to pick up rotated secrets, 0 for never
+}
+
+func (c secretsConfig) validate() error {
+	var errs []error
+	if c.Endpoint != "" {
+		if endpoint, err := url.Parse(c.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			errs = append(errs, fmt.Errorf("secrets.endpoint should be a URL such as http://localhost:4566, got %q", c.Endpoint))
+		}
+	}
+	if c.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("secrets.refresh_interval should be a duration such as 5m, 0 for never, got %s", c.RefreshInterval))
+	}
+	return errors.Join(errs...)
+}
+
+// SecretProvider looks up the current value of secrets kept outside of the
+// configuration, so that they can be rotated without touching it.
+type SecretProvider interface {
+	// GetSecret returns the value of the secret named by the reference,
+	// the part of a setting after the scheme of the provider.
+	GetSecret(ctx context.Context, ref string) (string, error)
+}
+
+// secretResolver resolves settings referencing a secret as scheme://ref
+// with the provider of the scheme. Other settings are taken literally.
+type secretResolver map[string]SecretProvider
+
+func newSecretResolver(config secretsConfig) secretResolver {
+	return secretResolver{
+		"file":           fileSecrets{},
+		"secretsmanager": newSecretsManagerSecrets(config),
+	}
+}
+
+// isSecretRef tells whether a setting references a secret rather than
+// being one.
+func isSecretRef(value string) bool {
+	for _, scheme := range []string{"file", "secretsmanager"} {
+		if strings.HasPrefix(value, scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r secretResolver) resolve(ctx context.Context, value string) (string, error) {
+	if !isSecretRef(value) {
+		return value, nil
+	}
+	scheme, ref, _ := strings.Cut(value, "://")
+
+	provider, ok := r[scheme]
+	if !ok {
+		return "", fmt.Errorf("no provider of %s:// secrets", scheme)
+	}
+	secret, err := provider.GetSecret(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the secret %s: %w", value, err)
+	}
+	return secret, nil
+}
+
+// fileSecrets reads secrets from files, such as those mounted by systemd
+// credentials or a secrets volume: file:///run/secrets/db_password
+type fileSecrets struct{}
+
+func (fileSecrets) GetSecret(ctx context.Context, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// secretsManagerSecrets reads secrets from AWS Secrets Manager. A reference
+// names the secret and, for secrets holding a JSON object such as those
+// rotated by RDS, the key of the value after a #:
+// secretsmanager://webapp/db#password
+type secretsManagerSecrets struct {
+	client *secretsmanager.SecretsManager
+}
+
+// newSecretsManagerSecrets returns the provider of the region of the
+// config, talking to its endpoint instead of AWS when one is given, such as
+// a local stand-in. AWS credentials are only looked up once a secret is
+// read, so instances not using Secrets Manager don't need any.
+func newSecretsManagerSecrets(config secretsConfig) *secretsManagerSecrets {
+	awsConfig := &aws.Config{Region: aws.String(config.Region)}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+	return &secretsManagerSecrets{client: secretsmanager.New(session.Must(session.NewSession(awsConfig)))}
+}
+
+func (s *secretsManagerSecrets) GetSecret(ctx context.Context, ref string) (string, error) {
+	id, key, hasKey := strings.Cut(ref, "#")
+
+	output, err := s.client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", err
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("%s isn't a text secret", id)
+	}
+	if !hasKey {
+		return *output.SecretString, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(*output.SecretString), &values); err != nil {
+		return "", fmt.Errorf("%s doesn't hold a JSON object", id) // the error would quote it
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("%s has no %s key", id, key)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	return fmt.Sprint(value), nil
+}
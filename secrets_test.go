@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// secretsManagerStandIn answers GetSecretValue like Secrets Manager does,
+// from the secrets given by ID
+func secretsManagerStandIn(t *testing.T, secrets map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct{ SecretId string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		secret, ok := secrets[input.SecretId]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Name": input.SecretId, "SecretString": secret})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSecretResolver(t *testing.T) {
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	standIn := secretsManagerStandIn(t, map[string]string{
+		"webapp/db":    `{"username":"webapp","password":"r0tated","port":3306}`,
+		"webapp/token": "plain",
+	})
+
+	passwordFile := filepath.Join(t.TempDir(), "db_password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("fr0m-file\n"), 0600))
+
+	secrets := newSecretResolver(secretsConfig{Region: "us-east-1", Endpoint: standIn.URL})
+	ctx := context.Background()
+
+	for value, expected := range map[string]string{
+		"literal":                             "literal",
+		"file://" + passwordFile:              "fr0m-file",
+		"secretsmanager://webapp/db#password": "r0tated",
+		"secretsmanager://webapp/db#port":     "3306",
+		"secretsmanager://webapp/token":       "plain",
+	} {
+		secret, err := secrets.resolve(ctx, value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, secret, value)
+	}
+
+	_, err := secrets.resolve(ctx, "file://"+filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = secrets.resolve(ctx, "secretsmanager://webapp/db#token")
+	assert.ErrorContains(t, err, "webapp/db has no token key")
+	_, err = secrets.resolve(ctx, "secretsmanager://webapp/missing")
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
+
+func TestCredentialRotation(t *testing.T) {
+
+	passwordFile := filepath.Join(t.TempDir(), "db_password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("first"), 0600))
+
+	config := databaseConfig{User: "webapp", Password: "file://" + passwordFile, Host: "db.internal", Port: 3306, Name: "webapp"}
+	connector, err := newCredentialConnector(context.Background(), config, true, newSecretResolver(secretsConfig{Region: "us-east-1"}))
+	require.NoError(t, err)
+	assert.Equal(t, "first", connector.credentials.Passwd)
+	assert.Equal(t, "webapp", connector.credentials.DBName)
+
+	changed, err := connector.refresh(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// A rotated password is picked up by the next refresh
+	require.NoError(t, os.WriteFile(passwordFile, []byte("second"), 0600))
+	changed, err = connector.refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "second", connector.credentials.Passwd)
+
+	// An unreadable secret keeps the current credentials
+	require.NoError(t, os.Remove(passwordFile))
+	_, err = connector.refresh(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, "second", connector.credentials.Passwd)
+}
+
+func TestSecretReferencesInConfig(t *testing.T) {
+
+	file := writeConfigFile(t, `
+database:
+  user: webapp
+  password: secretsmanager://webapp/db#password
+  name: webapp
+sns:
+  topic_arn: arn:aws:sns:us-east-1:123456789012:submissions
+secrets:
+  endpoint: http://localhost:4566
+  refresh_interval: 1m
+`)
+
+	config, err := loadConfig(configFlags{file: file}, testEnv{}.get)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, config.Secrets.RefreshInterval)
+
+	// References don't disclose the secrets, so they are printed
+	assert.Equal(t, "secretsmanager://webapp/db#password", config.redacted().Database.Password)
+
+	_, err = loadConfig(configFlags{file: file}, testEnv{"SECRETS_ENDPOINT": "localhost"}.get)
+	assert.EqualError(t, err, `secrets.endpoint should be a URL such as http://localhost:4566, got "localhost"`)
+}
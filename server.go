@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// serverConfig holds the settings of the HTTP servers
+type serverConfig struct {
+	Addr            string        `yaml:"addr"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes  int           `yaml:"max_header_bytes"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // to drain requests and notifications
+
+	// TLS is served when both files are given, otherwise plain HTTP
+	TLSCertFile   string `yaml:"tls_cert_file"`
+	TLSKeyFile    string `yaml:"tls_key_file"`
+	TLSMinVersion string `yaml:"tls_min_version"` // 1.2 or 1.3
+
+	// The admin listener is only started when it has an address. It uses
+	// the certificate of the API unless given its own, and requires client
+	// certificates signed by the client CA when one is given.
+	AdminAddr         string `yaml:"admin_addr"`
+	AdminCertFile     string `yaml:"admin_tls_cert_file"`
+	AdminKeyFile      string `yaml:"admin_tls_key_file"`
+	AdminClientCAFile string `yaml:"admin_tls_client_ca_file"`
+}
+
+func (c serverConfig) validate() error {
+	var errs []error
+
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.ReadTimeout},
+		{"server.write_timeout", c.WriteTimeout},
+		{"server.idle_timeout", c.IdleTimeout},
+		{"server.shutdown_timeout", c.ShutdownTimeout},
+	}
+	for _, duration := range durations {
+		if duration.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s should be a positive duration such as 30s, got %s", duration.key, duration.value))
+		}
+	}
+
+	if c.MaxHeaderBytes <= 0 {
+		errs = append(errs, fmt.Errorf("server.max_header_bytes should be a positive number of bytes, got %d", c.MaxHeaderBytes))
+	}
+	if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+		errs = append(errs, fmt.Errorf("server.tls_min_version should be 1.2 or 1.3, got %q", c.TLSMinVersion))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("server.tls_cert_file and server.tls_key_file should be given together"))
+	}
+	if (c.AdminCertFile == "") != (c.AdminKeyFile == "") {
+		errs = append(errs, errors.New("server.admin_tls_cert_file and server.admin_tls_key_file should be given together"))
+	}
+	if c.AdminClientCAFile != "" && c.AdminCertFile == "" && c.TLSCertFile == "" {
+		errs = append(errs, errors.New("server.admin_tls_client_ca_file needs a certificate for the admin listener"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// newServers builds the API server and, when configured, the admin server,
+// along with the reloaders of their certificates.
+func newServers(config serverConfig) ([]*http.Server, []*certReloader, error) {
+	var reloaders []*certReloader
+
+	api := newServer(config, setupRouter())
+	var apiReloader *certReloader
+	if config.TLSCertFile != "" {
+		reloader, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to load the TLS certificate: %w", err)
+		}
+		apiReloader = reloader
+		reloaders = append(reloaders, reloader)
+		api.TLSConfig = newTLSConfig(reloader, tlsVersions[config.TLSMinVersion], nil)
+	}
+
+	if config.AdminAddr == "" {
+		return []*http.Server{api}, reloaders, nil
+	}
+
+	adminConfig := config
+	adminConfig.Addr = config.AdminAddr
+	// Profiles are only served to clients with a certificate signed by the
+	// client CA, which needs the admin listener to serve TLS
+	admin := newServer(adminConfig, setupAdminRouter(config.AdminClientCAFile != ""))
+
+	adminReloader := apiReloader
+	if config.AdminCertFile != "" {
+		reloader, err := newCertReloader(config.AdminCertFile, config.AdminKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to load the admin TLS certificate: %w", err)
+		}
+		adminReloader = reloader
+		reloaders = append(reloaders, reloader)
+	}
+
+	if adminReloader != nil {
+		var clientCAs *x509.CertPool
+		if config.AdminClientCAFile != "" {
+			pool, err := loadCertPool(config.AdminClientCAFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to load the admin client CA: %w", err)
+			}
+			clientCAs = pool
+		}
+		admin.TLSConfig = newTLSConfig(adminReloader, tlsVersions[config.TLSMinVersion], clientCAs)
+	}
+
+	return []*http.Server{api, admin}, reloaders, nil
+}
+
+func newServer(config serverConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+}
+
+// serve runs the servers until one fails or the context is cancelled, which
+// is when the process is asked to stop.
+func serve(ctx context.Context, servers []*http.Server) error {
+	failed := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Info().Str("addr", server.Addr).Bool("tls", server.TLSConfig != nil).Msg("Listening for requests")
+			if server.TLSConfig != nil {
+				failed <- server.ListenAndServeTLS("", "") // certificates come from the TLS config
+				return
+			}
+			failed <- server.ListenAndServe()
+		}(server)
+	}
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// shutdown stops accepting connections, then waits for the requests in
+// flight, the queued notifications and the scheduler within the timeout
+// before closing the database pool.
+func shutdown(servers []*http.Server, timeout time.Duration, scheduler <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Info().Dur("timeout", timeout).Msg("Shutting down, draining the requests in flight")
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Error().Err(err).Str("addr", server.Addr).Msg("Requests were still in flight at the shutdown deadline")
+			}
+		}(server)
+	}
+	wg.Wait()
+
+	// Requests still in flight past the deadline drop their notifications
+	if notifications != nil {
+		if err := notifications.drain(ctx); err != nil {
+			log.Error().Err(err).Msg("Notifications were still queued at the shutdown deadline")
+		}
+	}
+
+	if err := flushTraces(ctx); err != nil {
+		log.Error().Err(err).Msg("Unable to export the remaining spans")
+	}
+
+	select {
+	case <-scheduler:
+	case <-ctx.Done():
+		log.Error().Msg("The publish scheduler was still running at the shutdown deadline")
+	}
+
+	if db != nil {
+		if sqlDB, err := db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil {
+				log.Error().Err(err).Msg("Unable to close the database connections")
+			}
+		}
+	}
+
+	log.Info().Msg("Shut down")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConfig(t *testing.T) {
+
+	env := testEnv{"DB_USER": "webapp", "DB_NAME": "webapp", "SNS_TOPIC_ARN": "arn:aws:sns:us-east-1:123456789012:submissions"}
+
+	config, err := loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, ":8080", config.Server.Addr)
+	assert.Equal(t, 15*time.Second, config.Server.ReadTimeout)
+	assert.Equal(t, 1<<20, config.Server.MaxHeaderBytes)
+	assert.Equal(t, "1.2", config.Server.TLSMinVersion)
+
+	env["PORT"] = "9000"
+	env["HTTP_WRITE_TIMEOUT"] = "1m"
+	env["HTTP_MAX_HEADER_BYTES"] = "4096"
+	config, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", config.Server.Addr)
+	assert.Equal(t, time.Minute, config.Server.WriteTimeout)
+	assert.Equal(t, 4096, config.Server.MaxHeaderBytes)
+
+	// HTTP_ADDR wins over PORT
+	env["HTTP_ADDR"] = "127.0.0.1:8081"
+	config, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8081", config.Server.Addr)
+
+	// So does the address of the file
+	delete(env, "HTTP_ADDR")
+	config, err = loadConfig(configFlags{file: writeConfigFile(t, "server:\n  addr: 127.0.0.1:8082\n")}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8082", config.Server.Addr)
+	env["HTTP_ADDR"] = "127.0.0.1:8081"
+
+	env["SHUTDOWN_TIMEOUT"] = "soon"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, `SHUTDOWN_TIMEOUT should be a duration such as 30s, got "soon"`)
+	env["SHUTDOWN_TIMEOUT"] = "-1s"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, "server.shutdown_timeout should be a positive duration such as 30s, got -1s")
+	delete(env, "SHUTDOWN_TIMEOUT")
+
+	// TLS settings have to make sense together
+	env["TLS_MIN_VERSION"] = "1.3"
+	config, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.3", config.Server.TLSMinVersion)
+
+	env["TLS_MIN_VERSION"] = "1.0"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, `server.tls_min_version should be 1.2 or 1.3, got "1.0"`)
+	delete(env, "TLS_MIN_VERSION")
+
+	env["TLS_CERT_FILE"] = "/etc/webapp/tls.crt"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, "server.tls_cert_file and server.tls_key_file should be given together")
+	delete(env, "TLS_CERT_FILE")
+
+	env["ADMIN_ADDR"] = "127.0.0.1:9443"
+	env["ADMIN_TLS_CLIENT_CA_FILE"] = "/etc/webapp/clients.crt"
+	_, err = loadConfig(configFlags{file: emptyConfigFile(t)}, env.get)
+	assert.EqualError(t, err, "server.admin_tls_client_ca_file needs a certificate for the admin listener")
+}
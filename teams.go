@@ -0,0 +1,490 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errTeamFull = errors.New("TEAM FULL")
+var errAlreadyInTeam = errors.New("ALREADY IN A TEAM")
+var errAccountNotFound = errors.New("ACCOUNT NOT FOUND")
+var errNotEnrolled = errors.New("NOT ENROLLED")
+var errTeamHasSubmission = errors.New("TEAM HAS A SUBMISSION")
+
+// validateTeamSettings checks the team settings of an assignment input
+func validateTeamSettings(input *models.AssignmentInput) error {
+	switch input.TeamMode {
+	case "":
+		if input.MaxTeamSize != 0 {
+			return errors.New("max_team_size is only allowed on team assignments")
+		}
+	case models.TeamModeInstructor, models.TeamModeSelfSignup:
+		if input.MaxTeamSize < 0 || input.MaxTeamSize > 100 {
+			return errors.New("max_team_size should be between 0 and 100, 0 meaning unlimited")
+		}
+		if input.TeamMode == models.TeamModeSelfSignup && input.MaxTeamSize == 0 {
+			return errors.New("max_team_size is required for self signup teams")
+		}
+	default:
+		return errors.New("team_mode should be either instructor or self_signup")
+	}
+
+	return nil
+}
+
+func createTeam(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("createteam_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("CreateTeam Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CreateTeam Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findVisibleAssignment(c, "CreateTeam", userID)
+	if !ok || !isTeamAssignment(c, "CreateTeam", assignment) {
+		return
+	}
+
+	var input models.TeamInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Name == "" {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("CreateTeam Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "A team needs a name")
+		return
+	}
+
+	// The owner forms teams of any members, students can only sign themselves up
+	members := input.Members
+	if assignment.AccountID != userID {
+		if assignment.TeamMode != models.TeamModeSelfSignup {
+			err := errors.New("AUTHORIZATION ERROR")
+			requestLogger(c).Error().Err(err).Msg("CreateTeam Endpoint:Teams of this assignment are formed by the instructor")
+			abortWithProblem(c, http.StatusForbidden, "AUTHORIZATION_ERROR", "Teams of this assignment are formed by the instructor")
+			return
+		}
+		userEmail, _, _ := c.Request.BasicAuth()
+		members = []string{userEmail}
+	}
+
+	if assignment.MaxTeamSize > 0 && len(members) > assignment.MaxTeamSize {
+		err := errTeamFull
+		requestLogger(c).Error().Err(err).Msg("CreateTeam Endpoint:The team has too many members")
+		abortWithProblem(c, http.StatusBadRequest, "TEAM_TOO_LARGE", "Teams of this assignment have at most "+strconv.Itoa(assignment.MaxTeamSize)+" members")
+		return
+	}
+
+	team := models.Team{AssignmentID: assignment.ID, Name: input.Name}
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&team).Error; err != nil {
+			return err
+		}
+
+		for _, email := range members {
+			var account models.Account
+			if err := tx.Where("email = ?", email).First(&account).Error; err != nil {
+				return errAccountNotFound
+			}
+			if err := addTeamMember(tx, assignment, team.ID, account.ID); err != nil {
+				return err
+			}
+		}
+
+		return recordAudit(tx, userID, "team.create", "team", team.ID, input)
+	})
+	if !teamChangeSucceeded(c, "CreateTeam", err) {
+		return
+	}
+
+	requestLogger(c).Info().Msg("CreateTeam Endpoint:Successfully created the team")
+
+	respondWithTeam(c, http.StatusCreated, team.ID)
+}
+
+func getTeams(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("getteams_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetTeams Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetTeams Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findVisibleAssignment(c, "GetTeams", userID)
+	if !ok || !isTeamAssignment(c, "GetTeams", assignment) {
+		return
+	}
+
+	var teams []models.Team
+	if err := requestDB(c).Preload("Members.Account").Where("assignment_id = ?", assignment.ID).Find(&teams).Error; err != nil {
+		err := errors.New("TEAM RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetTeams Endpoint:Unable to retrieve teams from database")
+		abortWithProblem(c, http.StatusInternalServerError, "TEAM_RETRIEVAL_ERROR", "Unable to retrieve teams from database")
+		return
+	}
+
+	teamResponses := []models.TeamResponse{}
+	for _, team := range teams {
+		teamResponses = append(teamResponses, newTeamResponse(team))
+	}
+
+	requestLogger(c).Info().Msg("GetTeams Endpoint:Successfully retrieved the teams")
+
+	c.JSON(http.StatusOK, teamResponses)
+}
+
+func joinTeam(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("jointeam_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("JoinTeam Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("JoinTeam Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findVisibleAssignment(c, "JoinTeam", userID)
+	if !ok || !isSelfSignupAssignment(c, "JoinTeam", assignment) {
+		return
+	}
+
+	team, ok := findTeam(c, "JoinTeam", assignment)
+	if !ok {
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := addTeamMember(tx, assignment, team.ID, userID); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "team.join", "team", team.ID, gin.H{"account_id": userID})
+	})
+	if !teamChangeSucceeded(c, "JoinTeam", err) {
+		return
+	}
+
+	requestLogger(c).Info().Msg("JoinTeam Endpoint:Successfully joined the team")
+
+	respondWithTeam(c, http.StatusOK, team.ID)
+}
+
+func leaveTeam(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("leaveteam_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("LeaveTeam Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("LeaveTeam Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findVisibleAssignment(c, "LeaveTeam", userID)
+	if !ok || !isSelfSignupAssignment(c, "LeaveTeam", assignment) {
+		return
+	}
+
+	team, ok := findTeam(c, "LeaveTeam", assignment)
+	if !ok {
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeamWithoutSubmission(tx, assignment, team.ID); err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("team_id = ? AND account_id = ?", team.ID, userID).Delete(&models.TeamMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAccountNotFound
+		}
+
+		return recordAudit(tx, userID, "team.leave", "team", team.ID, gin.H{"account_id": userID})
+	})
+	if !teamChangeSucceeded(c, "LeaveTeam", err) {
+		return
+	}
+
+	requestLogger(c).Info().Msg("LeaveTeam Endpoint:Successfully left the team")
+
+	c.Status(http.StatusNoContent)
+}
+
+func deleteTeam(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("deleteteam_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("DeleteTeam Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("DeleteTeam Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "DeleteTeam", userID)
+	if !ok {
+		return
+	}
+
+	team, ok := findTeam(c, "DeleteTeam", assignment)
+	if !ok {
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeamWithoutSubmission(tx, assignment, team.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("team_id = ?", team.ID).Delete(&models.TeamMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&team).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "team.delete", "team", team.ID, gin.H{"name": team.Name})
+	})
+	if !teamChangeSucceeded(c, "DeleteTeam", err) {
+		return
+	}
+
+	requestLogger(c).Info().Msg("DeleteTeam Endpoint:Successfully deleted the team")
+
+	c.Status(http.StatusNoContent)
+}
+
+// addTeamMember adds the account to the team, making sure it is a student of
+// the course, isn't already in another team of the assignment and that the
+// team has room left. The team is locked until the end of the transaction so
+// that concurrent additions can't overfill it.
+func addTeamMember(tx *gorm.DB, assignment models.Assignment, teamID uint, accountID uint) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Team{}, teamID).Error; err != nil {
+		return err
+	}
+
+	if assignment.CourseID != nil && enrollmentRole(tx, *assignment.CourseID, accountID) != models.EnrollmentRoleStudent {
+		return errNotEnrolled
+	}
+
+	var count int64
+	if err := tx.Model(&models.TeamMember{}).Where("assignment_id = ? AND account_id = ?", assignment.ID, accountID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errAlreadyInTeam
+	}
+
+	if assignment.MaxTeamSize > 0 {
+		if err := tx.Model(&models.TeamMember{}).Where("team_id = ?", teamID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) >= assignment.MaxTeamSize {
+			return errTeamFull
+		}
+	}
+
+	// The account may have joined another team in the meantime
+	err := tx.Create(&models.TeamMember{TeamID: teamID, AssignmentID: assignment.ID, AccountID: accountID}).Error
+	if isDuplicateEntry(err) {
+		return errAlreadyInTeam
+	}
+	return err
+}
+
+// lockTeamWithoutSubmission locks the team until the end of the transaction
+// and makes sure it hasn't submitted yet. Members of a team that submitted
+// stay together, so they can't start over with the attempts of a new team.
+func lockTeamWithoutSubmission(tx *gorm.DB, assignment models.Assignment, teamID uint) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Team{}, teamID).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&models.Submission{}).Where("assignment_id = ? AND team_id = ?", assignment.ID, teamID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errTeamHasSubmission
+	}
+	return nil
+}
+
+// teamChangeSucceeded writes the error response matching the error of a team
+// change, and reports whether there was none.
+func teamChangeSucceeded(c *gin.Context, endpoint string, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case errTeamFull:
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The team is full")
+		abortWithProblem(c, http.StatusConflict, "TEAM_FULL", "The team is full")
+	case errAlreadyInTeam:
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The account is already in a team")
+		abortWithProblem(c, http.StatusConflict, "ALREADY_IN_TEAM", "Account is already a member of a team of this assignment")
+	case errAccountNotFound:
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The account doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "ACCOUNT_NOT_FOUND", "Account not found")
+	case errTeamHasSubmission:
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The team has already submitted")
+		abortWithProblem(c, http.StatusConflict, "TEAM_HAS_SUBMISSION", "Members of a team that submitted the assignment can't leave it")
+	case errNotEnrolled:
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The account is not a student of the course")
+		abortWithProblem(c, http.StatusBadRequest, "NOT_ENROLLED", "Team members have to be students of the course of the assignment")
+	default:
+		err := errors.New("TEAM UPDATE ERROR")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:Failed to update the team")
+		abortWithProblem(c, http.StatusInternalServerError, "TEAM_UPDATE_ERROR", "Failed to update the team")
+	}
+
+	return false
+}
+
+func isTeamAssignment(c *gin.Context, endpoint string, assignment models.Assignment) bool {
+	if assignment.TeamMode == "" {
+		err := errors.New("NOT A TEAM ASSIGNMENT")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment is not a team assignment")
+		abortWithProblem(c, http.StatusBadRequest, "NOT_A_TEAM_ASSIGNMENT", "Assignment is not a team assignment")
+		return false
+	}
+
+	return true
+}
+
+func isSelfSignupAssignment(c *gin.Context, endpoint string, assignment models.Assignment) bool {
+	if assignment.TeamMode != models.TeamModeSelfSignup {
+		err := errors.New("NOT A SELF SIGNUP ASSIGNMENT")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The assignment doesn't allow self signup")
+		abortWithProblem(c, http.StatusBadRequest, "NOT_A_SELF_SIGNUP_ASSIGNMENT", "Assignment doesn't allow students to sign up to teams")
+		return false
+	}
+
+	return true
+}
+
+// findTeam loads the team referenced by the teamId parameter within the assignment
+func findTeam(c *gin.Context, endpoint string, assignment models.Assignment) (models.Team, bool) {
+	var team models.Team
+
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID TEAM ID")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The team ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_TEAM_ID", "Invalid team ID")
+		return team, false
+	}
+
+	if err := requestDB(c).Where("id = ? AND assignment_id = ?", teamID, assignment.ID).First(&team).Error; err != nil {
+		err := errors.New("TEAM NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The team doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "TEAM_NOT_FOUND", "Team not found")
+		return team, false
+	}
+
+	return team, true
+}
+
+// findTeamOf returns the team of the account for the assignment, with its members
+func findTeamOf(tx *gorm.DB, assignmentID uint, accountID uint) (*models.Team, error) {
+	var member models.TeamMember
+	if err := tx.Where("assignment_id = ? AND account_id = ?", assignmentID, accountID).First(&member).Error; err != nil {
+		return nil, err
+	}
+
+	var team models.Team
+	if err := tx.Preload("Members.Account").First(&team, member.TeamID).Error; err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+func teamID(team *models.Team) *uint {
+	if team == nil {
+		return nil
+	}
+
+	return &team.ID
+}
+
+func respondWithTeam(c *gin.Context, status int, id uint) {
+	var team models.Team
+	if err := requestDB(c).Preload("Members.Account").First(&team, id).Error; err != nil {
+		err := errors.New("TEAM RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("Team Endpoint:Unable to retrieve the team from database")
+		abortWithProblem(c, http.StatusInternalServerError, "TEAM_RETRIEVAL_ERROR", "Unable to retrieve the team from database")
+		return
+	}
+
+	c.JSON(status, newTeamResponse(team))
+}
+
+func newTeamResponse(team models.Team) models.TeamResponse {
+	return models.TeamResponse{
+		ID:           team.ID,
+		AssignmentID: team.AssignmentID,
+		Name:         team.Name,
+		Members:      team.MemberEmails(),
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"app/assignment/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeams(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	bob := testAccount(t, "bob@example.com")
+	cyd := testAccount(t, "cyd@example.com")
+	outsider := testAccount(t, "outsider@example.com")
+	course := models.Course{Name: "Cloud Computing", Code: "CSYE6225", AccountID: owner.ID}
+	require.NoError(t, db.Create(&course).Error)
+	require.NoError(t, db.Create(&[]models.Enrollment{
+		{CourseID: course.ID, AccountID: owner.ID, Role: models.EnrollmentRoleInstructor},
+		{CourseID: course.ID, AccountID: ada.ID, Role: models.EnrollmentRoleStudent},
+		{CourseID: course.ID, AccountID: bob.ID, Role: models.EnrollmentRoleStudent},
+		{CourseID: course.ID, AccountID: cyd.ID, Role: models.EnrollmentRoleStudent},
+	}).Error)
+	assignment := testAssignment(t, owner, func(assignment *models.Assignment) {
+		assignment.CourseID = &course.ID
+		assignment.TeamMode = models.TeamModeSelfSignup
+		assignment.MaxTeamSize = 2
+	})
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/teams"
+
+	create := func(email string, input models.TeamInput) (int, models.TeamResponse) {
+		t.Helper()
+		w := testRequest(router, http.MethodPost, path, email, input)
+		var team models.TeamResponse
+		json.Unmarshal(w.Body.Bytes(), &team)
+		return w.Code, team
+	}
+	join := func(email string, team models.TeamResponse, action string) *httptest.ResponseRecorder {
+		return testRequest(router, http.MethodPost, path+"/"+strconv.FormatUint(uint64(team.ID), 10)+"/"+action, email, nil)
+	}
+
+	// Members are students of the course
+	status, _ := create(owner.Email, models.TeamInput{Name: "Alpha", Members: []string{ada.Email, outsider.Email}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = create(owner.Email, models.TeamInput{Name: "Alpha", Members: []string{ada.Email, owner.Email}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	var teams int64
+	require.NoError(t, db.Model(&models.Team{}).Count(&teams).Error)
+	assert.Zero(t, teams)
+
+	status, alpha := create(owner.Email, models.TeamInput{Name: "Alpha", Members: []string{ada.Email}})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, []string{ada.Email}, alpha.Members)
+
+	assert.Equal(t, http.StatusOK, join(bob.Email, alpha, "join").Code)
+	response := join(cyd.Email, alpha, "join")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Contains(t, response.Body.String(), "TEAM_FULL")
+
+	status, beta := create(cyd.Email, models.TeamInput{Name: "Beta"})
+	require.Equal(t, http.StatusCreated, status)
+	response = join(ada.Email, beta, "join")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Contains(t, response.Body.String(), "ALREADY_IN_TEAM")
+
+	// Leaving a team frees the account for another one
+	assert.Equal(t, http.StatusNoContent, join(ada.Email, alpha, "leave").Code)
+	assert.Equal(t, http.StatusOK, join(ada.Email, beta, "join").Code)
+	assert.Equal(t, http.StatusNoContent, join(ada.Email, beta, "leave").Code)
+	assert.Equal(t, http.StatusOK, join(ada.Email, alpha, "join").Code)
+
+	// Deleting a team frees its members
+	assert.Equal(t, http.StatusNoContent, testRequest(router, http.MethodDelete, path+"/"+strconv.FormatUint(uint64(beta.ID), 10), owner.Email, nil).Code)
+	status, gamma := create(cyd.Email, models.TeamInput{Name: "Gamma"})
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, []string{cyd.Email}, gamma.Members)
+
+	// An account is in a single team of the assignment
+	err := db.Create(&models.TeamMember{TeamID: gamma.ID, AssignmentID: assignment.ID, AccountID: ada.ID}).Error
+	assert.True(t, isDuplicateEntry(err), "%v", err)
+}
+
+func TestTeamSubmissions(t *testing.T) {
+
+	testDatabase(t)
+	router := setupRouter()
+
+	published := notifications
+	notifications = newNotifier(func(ctx context.Context, message string) error { return nil }, time.Second, 100)
+	go notifications.run()
+	t.Cleanup(func() {
+		notifications.drain(context.Background())
+		notifications = published
+	})
+
+	owner := testAccount(t, "owner@example.com")
+	ada := testAccount(t, "ada@example.com")
+	bob := testAccount(t, "bob@example.com")
+	assignment := testAssignment(t, owner, func(assignment *models.Assignment) {
+		assignment.TeamMode = models.TeamModeSelfSignup
+		assignment.MaxTeamSize = 2
+	})
+	team := models.Team{AssignmentID: assignment.ID, Name: "Alpha"}
+	require.NoError(t, db.Create(&team).Error)
+	require.NoError(t, db.Create(&[]models.TeamMember{
+		{TeamID: team.ID, AssignmentID: assignment.ID, AccountID: ada.ID},
+		{TeamID: team.ID, AssignmentID: assignment.ID, AccountID: bob.ID},
+	}).Error)
+	path := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/submission"
+	teams := "/v1/assignments/" + strconv.FormatUint(uint64(assignment.ID), 10) + "/teams"
+	input := models.SubmissionInput{SubmissionUrl: "https://example.com/alpha.zip"}
+
+	// Members share the submission of the team
+	assert.Equal(t, http.StatusOK, testRequest(router, http.MethodPost, path, ada.Email, input).Code)
+	assert.Equal(t, http.StatusOK, testRequest(router, http.MethodPost, path, bob.Email, input).Code)
+
+	var submissions []models.Submission
+	require.NoError(t, db.Where("assignment_id = ?", assignment.ID).Find(&submissions).Error)
+	require.Len(t, submissions, 1)
+	assert.Equal(t, 2, submissions[0].SubmissionRetries)
+
+	// The attempts are shared as well
+	assert.Equal(t, http.StatusOK, testRequest(router, http.MethodPost, path, ada.Email, input).Code)
+	w := testRequest(router, http.MethodPost, path, bob.Email, input)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Contains(t, w.Body.String(), "ATTEMPTS_EXHAUSTED")
+
+	// Its members can't leave it for a team with attempts left
+	w = testRequest(router, http.MethodPost, teams+"/"+strconv.FormatUint(uint64(team.ID), 10)+"/leave", ada.Email, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "TEAM_HAS_SUBMISSION")
+	w = testRequest(router, http.MethodDelete, teams+"/"+strconv.FormatUint(uint64(team.ID), 10), owner.Email, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = testRequest(router, http.MethodPost, teams, ada.Email, models.TeamInput{Name: "Beta"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "ALREADY_IN_TEAM")
+	var members int64
+	require.NoError(t, db.Model(&models.TeamMember{}).Where("team_id = ?", team.ID).Count(&members).Error)
+	assert.Equal(t, int64(2), members)
+
+	// A team has a single submission row
+	err := db.Create(&models.Submission{AssignmentID: uint64(assignment.ID), AccountID: ada.ID, TeamID: &team.ID, SubmissionRetries: 1}).Error
+	assert.True(t, isDuplicateEntry(err), "%v", err)
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"app/assignment/controllers"
+	"app/assignment/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func cloneAssignment(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("cloneassignment_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("CloneAssignment Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	assignment, ok := findOwnedAssignment(c, "CloneAssignment", userID)
+	if !ok {
+		return
+	}
+
+	// The body is optional, an empty one clones the assignment as is
+	var cloneInput models.CloneInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&cloneInput); err != nil {
+			err := errors.New("INCORRECT REQUEST BODY")
+			requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:The request body is incorrect")
+			abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The request body is incorrect")
+			return
+		}
+	}
+
+	offset, err := cloneOffset(assignment, cloneInput)
+	if err != nil {
+		requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:The deadline shift is invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_DEADLINE_SHIFT", err.Error())
+		return
+	}
+
+	input := assignmentInputFromAssignment(assignment)
+	input.Deadline = shiftDate(input.Deadline, offset)
+	input.LateUntil = shiftDate(input.LateUntil, offset)
+	input.PublishAt = shiftDate(input.PublishAt, offset)
+	if cloneInput.Name != "" {
+		input.Name = cloneInput.Name
+	}
+	if cloneInput.CourseID != 0 {
+		input.CourseID = cloneInput.CourseID
+	}
+
+	if err := validateAssignmentInput(&input); err != nil {
+		requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:The cloned assignment is invalid")
+		abortWithInvalidInput(c, "INVALID_ASSIGNMENT", err)
+		return
+	}
+
+	courseID, err := assignmentCourse(requestDB(c), input.CourseID, userID)
+	if errors.Is(err, errCourseRequired) {
+		requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:The course of the clone is missing")
+		abortWithProblem(c, http.StatusBadRequest, "COURSE_REQUIRED", "The assignment has no course, the clone needs a course_id")
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:The user is not an instructor of the course")
+		abortWithProblem(c, http.StatusForbidden, "NOT_COURSE_INSTRUCTOR", "You are not an instructor of this course")
+		return
+	}
+
+	clone := newAssignmentFromInput(input, userID, courseID)
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+		if err := recordRevision(tx, userID, revisionCreate, clone); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, userID, "assignment.clone", "assignment", clone.ID, gin.H{"from": assignment.ID, "offset": offset.String()})
+	})
+	if err != nil {
+		err := errors.New("ASSIGNMENT CREATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CloneAssignment Endpoint:An error occured while cloning the assignment")
+		abortWithProblem(c, http.StatusInternalServerError, "ASSIGNMENT_CREATION_ERROR", "An error occured while cloning the assignment")
+		return
+	}
+
+	requestLogger(c).Info().Msg("CloneAssignment Endpoint:Successfully cloned the assignment")
+
+	renderAssignment(c, http.StatusCreated, clone)
+}
+
+// cloneOffset returns how far the dates of a clone move, either by the given
+// offset or to the given target deadline.
+func cloneOffset(assignment models.Assignment, cloneInput models.CloneInput) (time.Duration, error) {
+	if cloneInput.DeadlineOffset != "" && cloneInput.Deadline != "" {
+		return 0, errors.New("give either deadline_offset or deadline, not both")
+	}
+
+	if cloneInput.DeadlineOffset != "" {
+		offset, err := time.ParseDuration(cloneInput.DeadlineOffset)
+		if err != nil {
+			return 0, errors.New("deadline_offset should be a duration such as 168h")
+		}
+		return offset, nil
+	}
+
+	if cloneInput.Deadline != "" {
+		target, err := time.Parse(deadlineLayout, cloneInput.Deadline)
+		if err != nil {
+			return 0, errors.New("deadline should be in the format " + deadlineLayout)
+		}
+		deadline, err := time.Parse(deadlineLayout, assignment.Deadline)
+		if err != nil {
+			return 0, errors.New("deadline of the cloned assignment can't be parsed, give a deadline_offset instead")
+		}
+		return target.Sub(deadline), nil
+	}
+
+	return 0, nil
+}
+
+// shiftDate moves a date in the deadline format, leaving empty or
+// unparseable dates untouched.
+func shiftDate(date string, offset time.Duration) string {
+	t, err := time.Parse(deadlineLayout, date)
+	if err != nil || offset == 0 {
+		return date
+	}
+
+	return t.Add(offset).Format(deadlineLayout)
+}
+
+func createTemplate(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("createtemplate_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("CreateTemplate Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CreateTemplate Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	var input models.TemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("CreateTemplate Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "The request body is incorrect")
+		return
+	}
+
+	// Templates can be saved from one of the caller's assignments
+	if input.AssignmentID != 0 {
+		var assignment models.Assignment
+		if err := withRubric(requestDB(c)).Where("id = ? AND account_id = ?", input.AssignmentID, userID).First(&assignment).Error; err != nil {
+			err := errors.New("ASSIGNMENT NOT FOUND")
+			requestLogger(c).Error().Err(err).Msg("CreateTemplate Endpoint:The assignment doesn't exist")
+			abortWithProblem(c, http.StatusNotFound, "ASSIGNMENT_NOT_FOUND", "Assignment not found")
+			return
+		}
+		name := input.Name
+		input = templateInputFromAssignment(assignment)
+		if name != "" {
+			input.Name = name
+		}
+	}
+
+	template := models.AssignmentTemplate{
+		AccountID:          userID,
+		Name:               input.Name,
+		Points:             input.Points,
+		NoOfAttempts:       input.NoOfAttempts,
+		LatePolicy:         input.LatePolicy,
+		GracePeriodMinutes: input.GracePeriodMinutes,
+		LateWindowMinutes:  input.LateWindowMinutes,
+		LatePenaltyPerDay:  input.LatePenaltyPerDay,
+		TeamMode:           input.TeamMode,
+		MaxTeamSize:        input.MaxTeamSize,
+		Rubric:             input.Rubric,
+	}
+
+	// A template has to produce valid assignments, check it with a sample deadline
+	sample := assignmentInputFromTemplate(template, models.TemplateInstance{Deadline: time.Now().UTC().AddDate(1, 0, 0).Format(deadlineLayout)})
+	if err := validateAssignmentInput(&sample); err != nil {
+		requestLogger(c).Error().Err(err).Msg("CreateTemplate Endpoint:The template is invalid")
+		abortWithInvalidInput(c, "INVALID_TEMPLATE", err)
+		return
+	}
+	template.LatePolicy = sample.LatePolicy
+
+	if err := requestDB(c).Create(&template).Error; err != nil {
+		err := errors.New("TEMPLATE CREATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("CreateTemplate Endpoint:An error occured while creating the template")
+		abortWithProblem(c, http.StatusInternalServerError, "TEMPLATE_CREATION_ERROR", "An error occured while creating the template")
+		return
+	}
+
+	requestLogger(c).Info().Msg("CreateTemplate Endpoint:Successfully created the template")
+
+	c.JSON(http.StatusCreated, newTemplateResponse(template))
+}
+
+func getTemplates(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("gettemplates_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetTemplates Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetTemplates Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	var templates []models.AssignmentTemplate
+	if err := requestDB(c).Where("account_id = ?", userID).Find(&templates).Error; err != nil {
+		err := errors.New("TEMPLATE RETRIEVAL ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetTemplates Endpoint:Unable to retrieve templates from database")
+		abortWithProblem(c, http.StatusInternalServerError, "TEMPLATE_RETRIEVAL_ERROR", "Unable to retrieve templates from database")
+		return
+	}
+
+	templateResponses := []models.TemplateResponse{}
+	for _, template := range templates {
+		templateResponses = append(templateResponses, newTemplateResponse(template))
+	}
+
+	requestLogger(c).Info().Msg("GetTemplates Endpoint:Successfully retrieved the templates")
+
+	c.JSON(http.StatusOK, templateResponses)
+}
+
+func getTemplate(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("gettemplate_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("GetTemplate Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("GetTemplate Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	template, ok := findOwnedTemplate(c, "GetTemplate", userID)
+	if !ok {
+		return
+	}
+
+	requestLogger(c).Info().Msg("GetTemplate Endpoint:Successfully retrieved the template")
+
+	c.JSON(http.StatusOK, newTemplateResponse(template))
+}
+
+func deleteTemplate(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("deletetemplate_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("DeleteTemplate Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("DeleteTemplate Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	template, ok := findOwnedTemplate(c, "DeleteTemplate", userID)
+	if !ok {
+		return
+	}
+
+	if err := requestDB(c).Delete(&template).Error; err != nil {
+		err := errors.New("DELETE ERROR")
+		requestLogger(c).Error().Err(err).Msg("DeleteTemplate Endpoint:Failed to delete the template")
+		abortWithProblem(c, http.StatusInternalServerError, "DELETE_ERROR", "Failed to delete the template")
+		return
+	}
+
+	requestLogger(c).Info().Msg("DeleteTemplate Endpoint:Successfully deleted the template")
+
+	c.Status(http.StatusNoContent)
+}
+
+// instantiateTemplate creates one assignment per requested instance of the
+// template. Either every assignment is created or none is.
+func instantiateTemplate(c *gin.Context) {
+
+	// Increment the counter metric every time the API is hit
+	appMetrics.Count("instantiatetemplate_counter")
+
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	requestLogger(c).Info().Msg("InstantiateTemplate Endpoint")
+
+	// Authenticate the user and obtain their user ID
+	userID, err := controllers.AuthenticateUser(c, db)
+	if err != nil {
+		err := errors.New("AUTHENTICATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("InstantiateTemplate Endpoint:Unable to authenticate the request")
+		abortWithProblem(c, http.StatusUnauthorized, "AUTHENTICATION_ERROR", "Authentication Failed!")
+		return
+	}
+
+	template, ok := findOwnedTemplate(c, "InstantiateTemplate", userID)
+	if !ok {
+		return
+	}
+
+	var input models.InstantiateInput
+	if err := c.ShouldBindJSON(&input); err != nil || len(input.Assignments) == 0 {
+		err := errors.New("INCORRECT REQUEST BODY")
+		requestLogger(c).Error().Err(err).Msg("InstantiateTemplate Endpoint:The request body is incorrect")
+		abortWithProblem(c, http.StatusBadRequest, "INCORRECT_REQUEST_BODY", "At least one assignment to create is needed")
+		return
+	}
+
+	// Validate every assignment before creating any of them
+	newAssignments := []models.Assignment{}
+	validationErrors := []string{}
+	for i, instance := range input.Assignments {
+		assignmentInput := assignmentInputFromTemplate(template, instance)
+		if err := validateAssignmentInput(&assignmentInput); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("assignment %d: %s", i+1, describeInvalidInput(err)))
+			continue
+		}
+		courseID, err := assignmentCourse(requestDB(c), assignmentInput.CourseID, userID)
+		if errors.Is(err, errCourseRequired) {
+			validationErrors = append(validationErrors, fmt.Sprintf("assignment %d: course_id is required", i+1))
+			continue
+		}
+		if err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("assignment %d: you are not an instructor of course %d", i+1, assignmentInput.CourseID))
+			continue
+		}
+		newAssignments = append(newAssignments, newAssignmentFromInput(assignmentInput, userID, courseID))
+	}
+	if len(validationErrors) > 0 {
+		err := errors.New("INVALID ASSIGNMENTS")
+		requestLogger(c).Error().Err(err).Msg("InstantiateTemplate Endpoint:Some assignments are invalid")
+		abortWithError(c, &problemError{Status: http.StatusBadRequest, Code: "INVALID_ASSIGNMENTS", Detail: "Some assignments are invalid", Errors: validationErrors})
+		return
+	}
+
+	err = requestDB(c).Transaction(func(tx *gorm.DB) error {
+		for i := range newAssignments {
+			if err := tx.Create(&newAssignments[i]).Error; err != nil {
+				return err
+			}
+			if err := recordRevision(tx, userID, revisionCreate, newAssignments[i]); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, userID, "assignment.instantiate", "assignment", newAssignments[i].ID, gin.H{"template": template.ID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		err := errors.New("ASSIGNMENT CREATION ERROR")
+		requestLogger(c).Error().Err(err).Msg("InstantiateTemplate Endpoint:An error occured while creating the assignments")
+		abortWithProblem(c, http.StatusInternalServerError, "ASSIGNMENT_CREATION_ERROR", "An error occured while creating the assignments")
+		return
+	}
+
+	requestLogger(c).Info().Int("assignments", len(newAssignments)).Msg("InstantiateTemplate Endpoint:Successfully created the assignments")
+
+	c.JSON(http.StatusCreated, assignmentResponses(c, newAssignments))
+}
+
+// findOwnedTemplate loads the template referenced by the id parameter among
+// the templates of the account. When it isn't found, the error response is
+// written and false is returned.
+func findOwnedTemplate(c *gin.Context, endpoint string, userID uint) (models.AssignmentTemplate, bool) {
+	var template models.AssignmentTemplate
+
+	templateID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		err := errors.New("INVALID TEMPLATE ID")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The template ID is Invalid")
+		abortWithProblem(c, http.StatusBadRequest, "INVALID_TEMPLATE_ID", "Invalid template ID")
+		return template, false
+	}
+
+	if err := requestDB(c).Where("id = ? AND account_id = ?", templateID, userID).First(&template).Error; err != nil {
+		err := errors.New("TEMPLATE NOT FOUND")
+		requestLogger(c).Error().Err(err).Msg(endpoint + " Endpoint:The template doesn't exist")
+		abortWithProblem(c, http.StatusNotFound, "TEMPLATE_NOT_FOUND", "Template not found")
+		return template, false
+	}
+
+	return template, true
+}
+
+func newTemplateResponse(template models.AssignmentTemplate) models.TemplateResponse {
+	rubric := template.Rubric
+	if rubric == nil {
+		rubric = []models.RubricCriterionInput{}
+	}
+
+	return models.TemplateResponse{
+		ID:                 template.ID,
+		Name:               template.Name,
+		Points:             template.Points,
+		NoOfAttempts:       template.NoOfAttempts,
+		LatePolicy:         template.LatePolicy,
+		GracePeriodMinutes: template.GracePeriodMinutes,
+		LateWindowMinutes:  template.LateWindowMinutes,
+		LatePenaltyPerDay:  template.LatePenaltyPerDay,
+		TeamMode:           template.TeamMode,
+		MaxTeamSize:        template.MaxTeamSize,
+		Rubric:             rubric,
+		Created:            template.CreatedAt.String(),
+	}
+}
+
+func templateInputFromAssignment(assignment models.Assignment) models.TemplateInput {
+	input := assignmentInputFromAssignment(assignment)
+
+	lateWindow := 0
+	deadline, errDeadline := time.Parse(deadlineLayout, assignment.Deadline)
+	lateUntil, errLateUntil := time.Parse(deadlineLayout, assignment.LateUntil)
+	if errDeadline == nil && errLateUntil == nil {
+		lateWindow = int(lateUntil.Sub(deadline).Minutes())
+	}
+
+	return models.TemplateInput{
+		Name:               input.Name,
+		Points:             input.Points,
+		NoOfAttempts:       input.NoOfAttempts,
+		LatePolicy:         input.LatePolicy,
+		GracePeriodMinutes: input.GracePeriodMinutes,
+		LateWindowMinutes:  lateWindow,
+		LatePenaltyPerDay:  input.LatePenaltyPerDay,
+		TeamMode:           input.TeamMode,
+		MaxTeamSize:        input.MaxTeamSize,
+		Rubric:             input.Rubric,
+	}
+}
+
+// assignmentInputFromTemplate returns the input of an assignment created from
+// the template, the late-until date being derived from the deadline.
+func assignmentInputFromTemplate(template models.AssignmentTemplate, instance models.TemplateInstance) models.AssignmentInput {
+	input := models.AssignmentInput{
+		Name:               template.Name,
+		Points:             template.Points,
+		NoOfAttempts:       template.NoOfAttempts,
+		Deadline:           instance.Deadline,
+		LatePolicy:         template.LatePolicy,
+		GracePeriodMinutes: template.GracePeriodMinutes,
+		LatePenaltyPerDay:  template.LatePenaltyPerDay,
+		PublishAt:          instance.PublishAt,
+		CourseID:           instance.CourseID,
+		TeamMode:           template.TeamMode,
+		MaxTeamSize:        template.MaxTeamSize,
+		Rubric:             template.Rubric,
+	}
+	if instance.Name != "" {
+		input.Name = instance.Name
+	}
+	if template.LatePolicy == models.LatePolicyLateUntil {
+		input.LateUntil = shiftDate(instance.Deadline, time.Duration(template.LateWindowMinutes)*time.Minute)
+	}
+
+	return input
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"app/assignment/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneOffset(t *testing.T) {
+
+	assignment := models.Assignment{Deadline: "2024-01-10T23:59:00.000Z"}
+
+	// Without a shift the dates are kept
+	offset, err := cloneOffset(assignment, models.CloneInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), offset)
+
+	offset, err = cloneOffset(assignment, models.CloneInput{DeadlineOffset: "168h"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-17T23:59:00Z", shiftDate(assignment.Deadline, offset))
+
+	// A target deadline moves every date by the same amount
+	offset, err = cloneOffset(assignment, models.CloneInput{Deadline: "2024-01-12T23:59:00.000Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-07T12:00:00Z", shiftDate("2024-01-05T12:00:00.000Z", offset))
+
+	_, err = cloneOffset(assignment, models.CloneInput{Deadline: "2024-09-10T23:59:00.000Z", DeadlineOffset: "1h"})
+	assert.Error(t, err)
+
+	_, err = cloneOffset(assignment, models.CloneInput{DeadlineOffset: "a week"})
+	assert.Error(t, err)
+
+	// Empty dates stay empty
+	assert.Equal(t, "", shiftDate("", time.Hour))
+}
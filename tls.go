@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// TLS versions accepted by server.tls_min_version
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader serves a certificate and key pair from disk, picking up new
+// files when they are replaced, e.g. by a certificate renewal.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch reloads the certificate whenever the directories of the files
+// change, until the context is cancelled. Directories are watched rather
+// than the files so replacements by rename or symlink swap are noticed. A
+// pair that can't be loaded, e.g. while half written, keeps the previous
+// certificate in use.
+func (r *certReloader) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range []string{filepath.Dir(r.certFile), filepath.Dir(r.keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			log.Error().Err(err).Str("file", r.certFile).Msg("Unable to watch the TLS certificate")
+		case event := <-watcher.Events:
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Error().Err(err).Str("file", r.certFile).Msg("Unable to reload the TLS certificate, keeping the previous one")
+				continue
+			}
+			log.Info().Str("file", r.certFile).Msg("Reloaded the TLS certificate")
+		}
+	}
+}
+
+// newTLSConfig builds the TLS settings of a listener serving the reloader's
+// certificate. With a client CA pool, clients have to present a certificate
+// signed by one of its CAs.
+func newTLSConfig(reloader *certReloader, minVersion uint16, clientCAs *x509.CertPool) *tls.Config {
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.getCertificate,
+	}
+	if clientCAs != nil {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+// loadCertPool reads the PEM encoded CA certificates of a file
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", file)
+	}
+	return pool, nil
+}
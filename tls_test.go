@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate issues a certificate for the name, signed by the parent or
+// self-signed when there is none.
+func testCertificate(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCertificate stores the certificate and key as PEM files
+func writeCertificate(t *testing.T, cert tls.Certificate, certFile string, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestAdminMutualTLS(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	ca := testCertificate(t, "ca", nil)
+	writeCertificate(t, ca, caFile, filepath.Join(dir, "ca.key"))
+	writeCertificate(t, testCertificate(t, "localhost", &ca), certFile, keyFile)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	clientCAs, err := loadCertPool(caFile)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(setupAdminRouter(true))
+	server.TLS = newTLSConfig(reloader, tls.VersionTLS12, clientCAs)
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots, ServerName: "localhost", Certificates: certs,
+		}}}
+	}
+
+	// Clients without a certificate signed by the CA are turned away
+	_, err = client().Get(server.URL + "/debug/pprof/symbol")
+	assert.Error(t, err)
+	_, err = client(testCertificate(t, "stranger", nil)).Get(server.URL + "/debug/pprof/symbol")
+	assert.Error(t, err)
+
+	operator := client(testCertificate(t, "operator", &ca))
+	resp, err := operator.Get(server.URL + "/debug/pprof/symbol")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The command line holds the flags, passwords included
+	resp, err = operator.Get(server.URL + "/debug/pprof/cmdline")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Replaced files are picked up while serving
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.watch(ctx)
+	time.Sleep(50 * time.Millisecond) // let the watcher start
+
+	renewed := testCertificate(t, "localhost", &ca)
+	writeCertificate(t, renewed, certFile, keyFile)
+	assert.Eventually(t, func() bool {
+		cert, _ := reloader.getCertificate(nil)
+		return string(cert.Certificate[0]) == string(renewed.Certificate[0])
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A broken pair keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	assert.Error(t, reloader.reload())
+	cert, _ := reloader.getCertificate(nil)
+	assert.Equal(t, renewed.Certificate[0], cert.Certificate[0])
+}
+
+func TestAdminProfiling(t *testing.T) {
+
+	// Without client certificates the profiles aren't served
+	router := setupAdminRouter(false)
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
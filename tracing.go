@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Name of the webapp in traces, unless OTEL_SERVICE_NAME says otherwise
+const serviceName = "webapp"
+
+var tracer = otel.Tracer("app/assignment")
+
+// tracingConfig holds the settings of the traces. The OTLP exporter is set
+// up by the standard OTEL_EXPORTER_OTLP_* environment variables.
+type tracingConfig struct {
+	Exporter string `yaml:"exporter"` // otlp, stdout or none
+}
+
+func (c tracingConfig) validate() error {
+	if c.Exporter != "otlp" && c.Exporter != "stdout" && c.Exporter != "none" {
+		return fmt.Errorf("tracing.exporter should be otlp, stdout or none, got %q", c.Exporter)
+	}
+	return nil
+}
+
+// setupTracing installs the tracer provider of the exporter of the config:
+// otlp sends spans over HTTP to the collector of OTEL_EXPORTER_OTLP_ENDPOINT
+// (a local collector by default), stdout prints them and none turns tracing
+// off. Trace context is propagated the W3C way either way.
+func setupTracing(ctx context.Context, config tracingConfig) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case "otlp":
+		otlp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return err
+		}
+		exporter = otlp
+	case "stdout":
+		stdout, err := stdouttrace.New()
+		if err != nil {
+			return err
+		}
+		exporter = stdout
+	default:
+		return nil
+	}
+
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(serviceName)),
+		resource.Environment(), // OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	)
+	if err != nil {
+		return err
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	))
+	return nil
+}
+
+// flushTraces exports the spans still buffered by the tracer provider
+func flushTraces(ctx context.Context) error {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		return provider.Shutdown(ctx)
+	}
+	return nil
+}
+
+// requestDB returns the database handle for queries of the request, so
+// their spans belong to its trace.
+func requestDB(c *gin.Context) *gorm.DB {
+	return db.WithContext(c.Request.Context())
+}
+
+// gormTracing is a gorm plugin giving every statement of a traced request
+// its own span. Statements outside of a trace, such as those of the publish
+// scheduler, aren't traced.
+type gormTracing struct{}
+
+const gormTracingSpanKey = "tracing:span"
+
+func (gormTracing) Name() string {
+	return "tracing"
+}
+
+func (gormTracing) Initialize(db *gorm.DB) error {
+	start := func(operation string) func(tx *gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx := tx.Statement.Context
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+			ctx, span := tracer.Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+			tx.Statement.Context = ctx
+			tx.InstanceSet(gormTracingSpanKey, span)
+		}
+	}
+	end := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(gormTracingSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		span.SetAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBSQLTable(tx.Statement.Table),
+			semconv.DBStatement(tx.Statement.SQL.String()), // with placeholders, not values
+			attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+		)
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			// Errors of MySQL may quote the values of the statement
+			err := logRedactor.redactError(tx.Error)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("tracing:before_create", start("create")),
+		callbacks.Create().After("gorm:create").Register("tracing:after_create", end),
+		callbacks.Query().Before("gorm:query").Register("tracing:before_query", start("query")),
+		callbacks.Query().After("gorm:query").Register("tracing:after_query", end),
+		callbacks.Update().Before("gorm:update").Register("tracing:before_update", start("update")),
+		callbacks.Update().After("gorm:update").Register("tracing:after_update", end),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", start("delete")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", end),
+		callbacks.Row().Before("gorm:row").Register("tracing:before_row", start("row")),
+		callbacks.Row().After("gorm:row").Register("tracing:after_row", end),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", start("raw")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", end),
+	)
+}
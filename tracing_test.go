@@ -0,0 +1,110 @@
+package main
+
+import (
+	"app/assignment/models"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestTracing(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	}()
+
+	// Statements are prepared but not run against MySQL
+	dryRun, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:password@tcp(127.0.0.1:1)/webapp", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	require.NoError(t, dryRun.Use(gormTracing{}))
+	previousDB := db
+	db = dryRun
+	defer func() { db = previousDB }()
+
+	// SNS answers like the Query API does, keeping the parameters it got
+	var published url.Values
+	snsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		published, _ = url.ParseQuery(string(body))
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`)
+	}))
+	defer snsServer.Close()
+	snsClient := sns.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(snsServer.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})))
+
+	router := gin.New()
+	router.Use(otelgin.Middleware(serviceName))
+	router.GET("/v1/assignments/:id", func(c *gin.Context) {
+		var assignment models.Assignment
+		requestDB(c).First(&assignment, c.Param("id"))
+		// Helpers are given the handle of the request as well
+		enrollmentRole(requestDB(c), 3, 7)
+		assert.NoError(t, publishToSNS(c.Request.Context(), snsClient, "arn:aws:sns:us-east-1:1:submissions", "{}"))
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/assignments/7", nil))
+
+	// Queries outside of a request aren't traced
+	var assignments []models.Assignment
+	db.WithContext(context.Background()).Find(&assignments)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "/v1/assignments/:id")
+	require.Contains(t, spans, "gorm.query")
+	require.Contains(t, spans, "sns.publish")
+	assert.Len(t, spans, 3)
+
+	request := spans["/v1/assignments/:id"].SpanContext()
+	var tables []string
+	for _, span := range recorder.Ended() {
+		if span.Name() != "gorm.query" {
+			continue
+		}
+		assert.Equal(t, request.SpanID(), span.Parent().SpanID())
+		for _, attribute := range span.Attributes() {
+			if attribute.Key == semconv.DBSQLTableKey {
+				tables = append(tables, attribute.Value.AsString())
+			}
+		}
+	}
+	assert.Equal(t, []string{"assignments", "enrollments"}, tables)
+
+	// Subscribers get the trace context of the publish span
+	publish := spans["sns.publish"]
+	assert.Equal(t, request.TraceID(), publish.SpanContext().TraceID())
+	assert.Equal(t, "traceparent", published.Get("MessageAttributes.entry.1.Name"))
+	assert.Equal(t, "00-"+publish.SpanContext().TraceID().String()+"-"+publish.SpanContext().SpanID().String()+"-01",
+		published.Get("MessageAttributes.entry.1.Value.StringValue"))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"app/assignment/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Unknown fields of JSON bodies are rejected instead of silently ignored
+	binding.EnableDecoderDisallowUnknownFields = true
+
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Field errors are reported with the JSON names of the fields
+	validate.RegisterTagNameFunc(jsonFieldName)
+	validate.RegisterValidation("deadline", isDeadline)
+	validate.RegisterValidation("future", isFuture)
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// isDeadline validates a date in the deadline format
+func isDeadline(fl validator.FieldLevel) bool {
+	_, err := time.Parse(deadlineLayout, fl.Field().String())
+	return err == nil
+}
+
+// isFuture validates a date in the deadline format that hasn't passed yet
+func isFuture(fl validator.FieldLevel) bool {
+	t, err := time.Parse(deadlineLayout, fl.Field().String())
+	return err == nil && t.After(time.Now())
+}
+
+// abortWithInvalidInput answers a request body that couldn't be bound or
+// validated, listing every invalid field when the error allows it.
+func abortWithInvalidInput(c *gin.Context, code string, err error) {
+	if fields, ok := fieldErrors(err); ok {
+		abortWithError(c, &problemError{Status: http.StatusBadRequest, Code: code, Detail: "Some fields are invalid", InvalidFields: fields})
+		return
+	}
+
+	detail := err.Error()
+	if errors.Is(err, io.EOF) {
+		detail = "The request body is empty"
+	}
+	abortWithProblem(c, http.StatusBadRequest, code, detail)
+}
+
+// describeInvalidInput turns a validation error into a single line, for the
+// reports of bulk operations.
+func describeInvalidInput(err error) string {
+	fields, ok := fieldErrors(err)
+	if !ok {
+		return err.Error()
+	}
+
+	reasons := []string{}
+	for _, field := range fields {
+		reasons = append(reasons, field.Field+" "+field.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// fieldErrors lists the invalid fields behind a binding error. The boolean
+// is false when the error isn't about particular fields.
+func fieldErrors(err error) ([]models.FieldError, bool) {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := []models.FieldError{}
+		for _, fieldError := range validationErrors {
+			// The namespace starts with the name of the validated struct
+			path := fieldError.Namespace()
+			if i := strings.Index(path, "."); i >= 0 {
+				path = path[i+1:]
+			}
+			fields = append(fields, models.FieldError{Field: path, Reason: fieldReason(fieldError)})
+		}
+		return fields, true
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return []models.FieldError{{Field: typeError.Field, Reason: "should be " + jsonTypeName(typeError.Type)}}, true
+	}
+
+	// The JSON decoder has no error type for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return []models.FieldError{{Field: strings.Trim(field, `"`), Reason: "is not a known field"}}, true
+	}
+
+	return nil, false
+}
+
+func fieldReason(fieldError validator.FieldError) string {
+	unit := ""
+	if fieldError.Kind() == reflect.String {
+		unit = " characters long"
+	}
+
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "should be at least " + fieldError.Param() + unit
+	case "max":
+		return "should be at most " + fieldError.Param() + unit
+	case "oneof":
+		return "should be one of " + strings.ReplaceAll(fieldError.Param(), " ", ", ")
+	case "url":
+		return "should be a URL"
+	case "deadline":
+		return "should be in the format " + deadlineLayout
+	case "future":
+		return "should be in the future"
+	default:
+		return fmt.Sprintf("failed the %s check", fieldError.Tag())
+	}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// Deadline of an assignment input checked by validateFutureDeadline
+type futureDeadline struct {
+	Deadline string `json:"deadline" binding:"future"`
+}
+
+// validateFutureDeadline checks that the deadline of an assignment input
+// hasn't passed, adding it to the invalid fields of the binding error so that
+// they are all reported at once. Only the create and update endpoints apply
+// it: imported, cloned and reverted assignments may keep a deadline that has
+// passed.
+func validateFutureDeadline(input *models.AssignmentInput, err error) error {
+	var fields validator.ValidationErrors
+	if err != nil && !errors.As(err, &fields) {
+		return err // the body couldn't be read
+	}
+	for _, field := range fields {
+		if field.Field() == "deadline" {
+			return err
+		}
+	}
+
+	var deadline validator.ValidationErrors
+	if !errors.As(binding.Validator.ValidateStruct(&futureDeadline{Deadline: input.Deadline}), &deadline) {
+		return err
+	}
+	return append(fields, deadline...)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"app/assignment/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignmentInputValidation(t *testing.T) {
+
+	input := models.AssignmentInput{
+		Name:         "Lab 1",
+		Points:       10,
+		NoOfAttempts: 1,
+		Deadline:     time.Now().Add(24 * time.Hour).UTC().Format(deadlineLayout),
+	}
+	assert.NoError(t, binding.Validator.ValidateStruct(&input))
+
+	// Every invalid field is reported with its JSON name
+	input = models.AssignmentInput{
+		Points:     101,
+		Deadline:   "2020-01-01T00:00:00.000Z",
+		LatePolicy: "never",
+		Rubric:     []models.RubricCriterionInput{{Weight: 1}},
+	}
+	fields, ok := fieldErrors(binding.Validator.ValidateStruct(&input))
+	assert.True(t, ok)
+	assert.Equal(t, []models.FieldError{
+		{Field: "name", Reason: "is required"},
+		{Field: "points", Reason: "should be at most 100"},
+		{Field: "noofattempts", Reason: "should be at least 1"},
+		{Field: "late_policy", Reason: "should be one of hard_cutoff, grace_period, late_until"},
+		{Field: "rubric[0].name", Reason: "is required"},
+	}, fields)
+
+	// Deadlines that have passed are only refused where they are set
+	input = models.AssignmentInput{Name: "Lab 1", Points: 10, NoOfAttempts: 1, Deadline: "2020-01-01T00:00:00.000Z"}
+	assert.NoError(t, validateAssignmentInput(&input))
+	fields, ok = fieldErrors(validateFutureDeadline(&input, nil))
+	assert.True(t, ok)
+	assert.Equal(t, []models.FieldError{{Field: "deadline", Reason: "should be in the future"}}, fields)
+
+	// The deadline is listed along with the other invalid fields
+	input.Name = ""
+	fields, _ = fieldErrors(validateFutureDeadline(&input, binding.Validator.ValidateStruct(&input)))
+	assert.Equal(t, []models.FieldError{{Field: "name", Reason: "is required"}, {Field: "deadline", Reason: "should be in the future"}}, fields)
+	input.Name = "Lab 1"
+
+	input.Deadline = time.Now().Add(time.Hour).UTC().Format(deadlineLayout)
+	assert.NoError(t, validateFutureDeadline(&input, nil))
+
+	submission := models.SubmissionInput{SubmissionUrl: "not a url"}
+	fields, _ = fieldErrors(binding.Validator.ValidateStruct(&submission))
+	assert.Equal(t, []models.FieldError{{Field: "submission_url", Reason: "should be a URL"}}, fields)
+}
+
+func TestInvalidInputProblem(t *testing.T) {
+
+	router := gin.New()
+	router.Use(problemMiddleware())
+	router.POST("/submission", func(c *gin.Context) {
+		var input models.SubmissionInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			abortWithInvalidInput(c, "INVALID_SUBMISSION", err)
+		}
+	})
+
+	// Unknown and mistyped fields are reported as invalid fields
+	for body, field := range map[string]string{
+		`{"submission_url": "https://example.com/a.zip", "extra": 1}`: `{"field":"extra","reason":"is not a known field"}`,
+		`{"submission_url": 1}`: `{"field":"submission_url","reason":"should be a string"}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/submission", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"invalid_fields":[`+field+`]`)
+	}
+}